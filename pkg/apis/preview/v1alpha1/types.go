@@ -15,6 +15,9 @@ type Preview struct {
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
 	Spec PreviewSpec `json:"spec,omitempty"`
+
+	// Status the status of the preview
+	Status PreviewStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -38,6 +41,21 @@ type Resources struct {
 
 	// Namespace the optional namespace unique for the pull request to deploy into
 	Namespace string `json:"namespace,omitempty" protobuf:"bytes,3,opt,name=namespace"`
+
+	// URLs all the URLs of the Ingresses, Routes, HTTPRoutes and Knative Services in the preview namespace
+	URLs []PreviewURL `json:"urls,omitempty" protobuf:"bytes,4,rep,name=urls"`
+}
+
+// PreviewURL a named URL of a preview
+type PreviewURL struct {
+	// Name the name of the URL which is usually the name of the resource exposing it
+	Name string `json:"name,omitempty" protobuf:"bytes,1,opt,name=name"`
+
+	// URL the URL
+	URL string `json:"url,omitempty" protobuf:"bytes,2,opt,name=url"`
+
+	// Kind the kind of resource exposing the URL such as Ingress, Route, HTTPRoute or Service
+	Kind string `json:"kind,omitempty" protobuf:"bytes,3,opt,name=kind"`
 }
 
 // PreviewSpec the spec of a pipeline request
@@ -53,6 +71,95 @@ type PreviewSpec struct {
 
 	// DestroyCommand the command to destroy the preview
 	DestroyCommand Command `json:"destroyCommand,omitempty" protobuf:"bytes,4,opt,name=destroyCommand"`
+
+	// Branch the branch or tag the preview was created from if it is not for a pull request.
+	// The owner and repository are still recorded in the PullRequest
+	Branch *PreviewBranch `json:"branch,omitempty" protobuf:"bytes,5,opt,name=branch"`
+
+	// LinkedPullRequests the pull requests of other repositories deployed into the same preview namespace.
+	// The preview is kept while the pull request or any linked pull request is open
+	LinkedPullRequests []PullRequest `json:"linkedPullRequests,omitempty" protobuf:"bytes,6,rep,name=linkedPullRequests"`
+}
+
+// DeployOutcome the outcome of deploying a preview
+type DeployOutcome string
+
+const (
+	// DeployOutcomeSucceeded the preview was deployed
+	DeployOutcomeSucceeded DeployOutcome = "Succeeded"
+
+	// DeployOutcomeFailed the preview failed to deploy
+	DeployOutcomeFailed DeployOutcome = "Failed"
+)
+
+// PreviewStatus the status of a preview
+type PreviewStatus struct {
+	// History the most recent deploys of the preview, oldest first
+	History []PreviewDeploy `json:"history,omitempty" protobuf:"bytes,1,rep,name=history"`
+
+	// Degraded the last deploy failed and the preview was rolled back to a previous deploy
+	Degraded bool `json:"degraded,omitempty" protobuf:"varint,2,opt,name=degraded"`
+
+	// ServingCommit the git commit the preview is serving
+	ServingCommit string `json:"servingCommit,omitempty" protobuf:"bytes,3,opt,name=servingCommit"`
+}
+
+// PreviewDeploy a deploy of the preview by jx preview create
+type PreviewDeploy struct {
+	// Commit the git commit which was deployed
+	Commit string `json:"commit,omitempty" protobuf:"bytes,1,opt,name=commit"`
+
+	// Version the version of the application which was deployed
+	Version string `json:"version,omitempty" protobuf:"bytes,2,opt,name=version"`
+
+	// BuildNumber the number of the pipeline build which deployed the preview
+	BuildNumber string `json:"buildNumber,omitempty" protobuf:"bytes,3,opt,name=buildNumber"`
+
+	// StartTime when the deploy started
+	StartTime metav1.Time `json:"startTime,omitempty" protobuf:"bytes,4,opt,name=startTime"`
+
+	// EndTime when the deploy completed
+	EndTime *metav1.Time `json:"endTime,omitempty" protobuf:"bytes,5,opt,name=endTime"`
+
+	// Outcome whether the deploy succeeded or failed
+	Outcome DeployOutcome `json:"outcome,omitempty" protobuf:"bytes,6,opt,name=outcome"`
+
+	// Message the error if the deploy failed
+	Message string `json:"message,omitempty" protobuf:"bytes,7,opt,name=message"`
+
+	// URL the URL of the preview after the deploy
+	URL string `json:"url,omitempty" protobuf:"bytes,8,opt,name=url"`
+
+	// Releases the helm releases of the preview and their revisions after the deploy
+	Releases []ReleaseRevision `json:"releases,omitempty" protobuf:"bytes,9,rep,name=releases"`
+
+	// RolledBackTo the commit of the previous deploy the preview was rolled back to after this deploy failed
+	RolledBackTo string `json:"rolledBackTo,omitempty" protobuf:"bytes,10,opt,name=rolledBackTo"`
+
+	// RolledBackReleases the helm releases which were rolled back to their revisions of the previous deploy after this deploy failed.
+	// If only some of the releases could be rolled back RolledBackTo is empty
+	RolledBackReleases []ReleaseRevision `json:"rolledBackReleases,omitempty" protobuf:"bytes,11,rep,name=rolledBackReleases"`
+}
+
+// ReleaseRevision the revision of a helm release
+type ReleaseRevision struct {
+	// Name the name of the release
+	Name string `json:"name,omitempty" protobuf:"bytes,1,opt,name=name"`
+
+	// Namespace the namespace of the release
+	Namespace string `json:"namespace,omitempty" protobuf:"bytes,2,opt,name=namespace"`
+
+	// Revision the revision of the release
+	Revision int `json:"revision,omitempty" protobuf:"bytes,3,opt,name=revision"`
+}
+
+// PreviewBranch the branch or tag of a preview which is not for a pull request
+type PreviewBranch struct {
+	// Name the name of the branch or tag
+	Name string `json:"name,omitempty" protobuf:"bytes,1,opt,name=name"`
+
+	// TTL how long the preview is kept after it was last updated. If not specified the preview is kept until the branch is removed
+	TTL *metav1.Duration `json:"ttl,omitempty" protobuf:"bytes,2,opt,name=ttl"`
 }
 
 // PreviewSource the location of the preview
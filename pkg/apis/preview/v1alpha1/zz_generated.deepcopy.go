@@ -20,6 +20,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -71,6 +72,7 @@ func (in *Preview) DeepCopyInto(out *Preview) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -92,6 +94,27 @@ func (in *Preview) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreviewBranch) DeepCopyInto(out *PreviewBranch) {
+	*out = *in
+	if in.TTL != nil {
+		in, out := &in.TTL, &out.TTL
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreviewBranch.
+func (in *PreviewBranch) DeepCopy() *PreviewBranch {
+	if in == nil {
+		return nil
+	}
+	out := new(PreviewBranch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PreviewList) DeepCopyInto(out *PreviewList) {
 	*out = *in
@@ -146,8 +169,18 @@ func (in *PreviewSpec) DeepCopyInto(out *PreviewSpec) {
 	*out = *in
 	out.Source = in.Source
 	out.PullRequest = in.PullRequest
-	out.Resources = in.Resources
+	in.Resources.DeepCopyInto(&out.Resources)
 	in.DestroyCommand.DeepCopyInto(&out.DestroyCommand)
+	if in.Branch != nil {
+		in, out := &in.Branch, &out.Branch
+		*out = new(PreviewBranch)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LinkedPullRequests != nil {
+		in, out := &in.LinkedPullRequests, &out.LinkedPullRequests
+		*out = make([]PullRequest, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -161,6 +194,76 @@ func (in *PreviewSpec) DeepCopy() *PreviewSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreviewDeploy) DeepCopyInto(out *PreviewDeploy) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.EndTime != nil {
+		in, out := &in.EndTime, &out.EndTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Releases != nil {
+		in, out := &in.Releases, &out.Releases
+		*out = make([]ReleaseRevision, len(*in))
+		copy(*out, *in)
+	}
+	if in.RolledBackReleases != nil {
+		in, out := &in.RolledBackReleases, &out.RolledBackReleases
+		*out = make([]ReleaseRevision, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreviewDeploy.
+func (in *PreviewDeploy) DeepCopy() *PreviewDeploy {
+	if in == nil {
+		return nil
+	}
+	out := new(PreviewDeploy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreviewStatus) DeepCopyInto(out *PreviewStatus) {
+	*out = *in
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]PreviewDeploy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreviewStatus.
+func (in *PreviewStatus) DeepCopy() *PreviewStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PreviewStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PreviewURL) DeepCopyInto(out *PreviewURL) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PreviewURL.
+func (in *PreviewURL) DeepCopy() *PreviewURL {
+	if in == nil {
+		return nil
+	}
+	out := new(PreviewURL)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PullRequest) DeepCopyInto(out *PullRequest) {
 	*out = *in
@@ -178,9 +281,30 @@ func (in *PullRequest) DeepCopy() *PullRequest {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReleaseRevision) DeepCopyInto(out *ReleaseRevision) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReleaseRevision.
+func (in *ReleaseRevision) DeepCopy() *ReleaseRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(ReleaseRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Resources) DeepCopyInto(out *Resources) {
 	*out = *in
+	if in.URLs != nil {
+		in, out := &in.URLs, &out.URLs
+		*out = make([]PreviewURL, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -26,8 +26,13 @@ import (
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/kserving"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/notify"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewurls"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
 	"github.com/jenkins-x/go-scm/scm"
 	jxc "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
@@ -41,13 +46,16 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/naming"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/services"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/scmhelpers"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	kserve "knative.dev/serving/pkg/client/clientset/versioned"
 )
@@ -61,7 +69,10 @@ var (
 
 	cmdExample = templates.Examples(`
 		# creates a new preview environment
-		%s create
+		%[1]s create
+
+		# creates a preview environment of a release branch which is removed a week after it was last updated
+		%[1]s create --branch-preview --branch release-1.2 --ttl 168h
 	`)
 
 	info = termcolor.ColorInfo
@@ -76,27 +87,50 @@ type Options struct {
 	Namespace        string
 	PreviewService   string
 	Selectors        []string
+	LinkPullRequests []string
 	DockerRegistry   string
 	BuildNumber      string
 	Version          string
 	GitUser          string
 	PreviewURLPath   string
+	TLSIssuer        string
+	AuthMode         string
+	TLSSecret        string
 
 	// PullRequestBranch used for testing to fake out the pull request branch name
 	PullRequestBranch     string
 	PreviewURLTimeout     time.Duration
+	TLSTimeout            time.Duration
+	LockTimeout           time.Duration
+	TTL                   time.Duration
+	BranchPreview         bool
+	TLS                   bool
+	RollbackOnFailure     bool
 	NoComment             bool
 	NoWatchNamespace      bool
 	Debug                 bool
 	GitClient             gitclient.Interface
 	PreviewClient         versioned.Interface
 	KubeClient            kubernetes.Interface
+	DynamicClient         dynamic.Interface
 	JXClient              jxc.Interface
 	KServeClient          kserve.Interface
+	URLFinder             previewurls.Finder
+	EventRecorder         previews.EventRecorder
+	Metrics               metrics.Options
+	Tracer                *tracing.Tracer
+	Notifier              notify.Notifier
 	CommandRunner         cmdrunner.CommandRunner
 	OutputEnvVars         map[string]string
 	WatchNamespaceCommand *exec.Cmd
 	Preview               *v1alpha1.Preview
+	Config                *previewconfig.Config
+
+	links              []v1alpha1.PullRequest
+	linkedPreview      *v1alpha1.Preview
+	rolledBackTo       *v1alpha1.PreviewDeploy
+	rolledBackReleases []v1alpha1.ReleaseRevision
+	phases             *tracing.Phases
 }
 
 type envVar struct {
@@ -128,8 +162,19 @@ func NewCmdPreviewCreate() (*cobra.Command, *Options) {
 	cmd.Flags().StringArrayVarP(&o.Selectors, "selector", "", []string{}, "Filters releases from the helmfile to deploy based on their labels. Can be repeated to apply multiple filters.")
 	cmd.Flags().DurationVarP(&o.PreviewURLTimeout, "preview-url-timeout", "", time.Minute+5, "Time to wait for the preview URL to be available")
 	cmd.Flags().BoolVarP(&o.NoComment, "no-comment", "", false, "Disables commenting on the Pull Request after preview is created")
+	cmd.Flags().StringArrayVarP(&o.LinkPullRequests, "link-pr", "", nil, "Links a pull request of another repository, as owner/repository#number or its URL, so that both are deployed into the same preview. Can be repeated. Pull requests can also be linked with a '"+previews.LinkDirective+" owner/repository#number' line in the pull request description")
+	cmd.Flags().BoolVarP(&o.BranchPreview, "branch-preview", "", false, "Creates a preview of the branch or tag specified by --branch rather than of a Pull Request")
+	cmd.Flags().DurationVarP(&o.TTL, "ttl", "", 0, "How long a branch preview is kept after it was last updated. If not specified it is kept until the branch is removed")
+	cmd.Flags().BoolVarP(&o.TLS, "tls", "", false, "Configures the preview Ingresses for TLS using the issuer or wildcard certificate from the preview configuration")
+	cmd.Flags().StringVarP(&o.TLSIssuer, "tls-issuer", "", "", "The cert-manager ClusterIssuer used to issue the certificates of the preview Ingresses. Implies --tls")
+	cmd.Flags().StringVarP(&o.TLSSecret, "tls-secret", "", "", "The wildcard certificate Secret in the preview namespace used by the preview Ingresses. Implies --tls")
+	cmd.Flags().DurationVarP(&o.TLSTimeout, "tls-timeout", "", 5*time.Minute, "Time to wait for the certificates of the preview Ingresses to be ready")
+	cmd.Flags().StringVarP(&o.AuthMode, "auth", "", "", "How the preview Ingresses are protected. Either none, basic or external. If not specified uses the preview configuration")
+	cmd.Flags().DurationVarP(&o.LockTimeout, "lock-timeout", "", previews.DefaultLockTimeout, "Time to wait for other runs deploying into the preview namespace to finish")
+	cmd.Flags().BoolVarP(&o.RollbackOnFailure, "rollback-on-failure", "", false, "Rolls the helm releases of the preview back to its last successful deploy if the helmfile sync fails")
 	cmd.Flags().BoolVarP(&o.NoWatchNamespace, "no-watch", "", false, "Disables watching the preview namespace as we deploy the preview")
 	cmd.Flags().BoolVarP(&o.Debug, "debug", "", false, "Enables debug logging in helmfile")
+	o.Metrics.AddFlags(cmd)
 
 	o.PullRequestOptions.AddFlags(cmd)
 	return cmd, o
@@ -143,35 +188,78 @@ func (o *Options) AddFlags(cmd *cobra.Command) {
 }
 
 // Run implements a helmfile based preview environment
-func (o *Options) Run() error {
-	err := o.Validate()
+func (o *Options) Run() (err error) {
+	startTime := metav1.Now()
+	o.startTrace()
+	defer func() {
+		o.endTrace(err)
+		o.recordMetrics(startTime.Time, o.phases.Name(), err)
+	}()
+	o.phases.Start("validate")
+	err = o.Validate()
 	if err != nil {
 		return fmt.Errorf("failed to validate options: %w", err)
 	}
+	defer o.EventRecorder.Flush()
 
-	pr, err := o.DiscoverPullRequest()
-	if err != nil {
-		return fmt.Errorf("failed to discover pull request: %w", err)
-	}
+	var pr *scm.PullRequest
+	if o.BranchPreview {
+		log.Logger().Infof("creating a preview of branch %s", info(o.Branch))
+	} else {
+		o.phases.Start("pull_request")
+		pr, err = o.DiscoverPullRequest()
+		if err != nil {
+			return fmt.Errorf("failed to discover pull request: %w", err)
+		}
 
-	log.Logger().Infof("found PullRequest %s", pr.Link)
+		log.Logger().Infof("found PullRequest %s", pr.Link)
+
+		err = o.linkPullRequests(pr)
+		if err != nil {
+			return fmt.Errorf("failed to link pull requests: %w", err)
+		}
+	}
+	o.traceAttributes(pr)
 
+	o.phases.Start("quota")
 	envVars, err := o.CreateHelmfileEnvVars(nil)
 	if err != nil {
 		return fmt.Errorf("failed to create env vars: %w", err)
 	}
 
+	err = o.enforceQuotas(pr, envVars["PREVIEW_NAMESPACE"])
+	if err != nil {
+		return fmt.Errorf("failed to enforce preview quotas: %w", err)
+	}
+
 	destroyCmd := o.createDestroyCommand(envVars)
 
 	// let's get the git clone URL with user/password so we can clone it again in the destroy command/CronJob
 	ctx := context.Background()
 
+	o.phases.Start("values")
 	_, err = previews.CreateJXValuesFile(o.GitClient, o.JXClient, o.Namespace, filepath.Dir(o.PreviewHelmfile), envVars["PREVIEW_NAMESPACE"], o.GitUser, o.GitToken)
 	if err != nil {
 		return fmt.Errorf("failed to create the jx-values.yaml file: %w", err)
 	}
 
-	preview, _, err := previews.GetOrCreatePreview(o.PreviewClient, o.Namespace, pr, &destroyCmd, pr.Repository().Link, envVars["PREVIEW_NAMESPACE"], o.PreviewHelmfile)
+	o.phases.Start("lock")
+	lock, err := o.lockPreview(pr, envVars["PREVIEW_NAMESPACE"])
+	if err != nil {
+		return fmt.Errorf("failed to lock preview namespace %s: %w", envVars["PREVIEW_NAMESPACE"], err)
+	}
+	defer func() {
+		releaseErr := lock.Release()
+		if releaseErr != nil {
+			log.Logger().Warnf("failed to release the lock of the preview: %s", releaseErr.Error())
+		}
+	}()
+
+	err = o.startPhase(lock, "upsert")
+	if err != nil {
+		return err
+	}
+	preview, err := o.upsertPreview(pr, &destroyCmd, envVars["PREVIEW_NAMESPACE"])
 	if err != nil {
 		return fmt.Errorf("failed to upsert the Preview resource in namespace %s: %w", o.Namespace, err)
 	}
@@ -179,8 +267,35 @@ func (o *Options) Run() error {
 		return fmt.Errorf("no upserted Preview resource in namespace %s", o.Namespace)
 	}
 	log.Logger().Infof("upserted preview %s", preview.Name)
+	o.phases.Root().SetAttributes(attribute.String("jx.preview.name", preview.Name), attribute.String("k8s.namespace.name", preview.Spec.Resources.Namespace))
+
+	err = o.startPhase(lock, "namespace")
+	if err != nil {
+		return err
+	}
+	_, err = previews.EnsurePreviewNamespace(o.KubeClient, o.Namespace, preview.Spec.Resources.Namespace, preview.Name)
+	if err != nil {
+		return fmt.Errorf("failed to ensure the preview namespace exists: %w", err)
+	}
+
+	err = previews.ApplyResourceLimits(o.KubeClient, preview.Spec.Resources.Namespace, o.Config.ResourceQuota, o.Config.LimitRange)
+	if err != nil {
+		return fmt.Errorf("failed to apply resource limits to the preview namespace: %w", err)
+	}
+	err = previews.ApplyNetworkPolicies(o.KubeClient, preview.Spec.Resources.Namespace, o.Config.NetworkPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to apply network policies to the preview namespace: %w", err)
+	}
+	err = previews.CopyResources(o.DynamicClient, o.Namespace, preview.Spec.Resources.Namespace, o.Config.CopyResources())
+	if err != nil {
+		return fmt.Errorf("failed to copy resources into the preview namespace: %w", err)
+	}
 
 	o.Preview = preview
+	o.EventRecorder.Eventf(preview, corev1.EventTypeNormal, previews.ReasonDeploying, "deploying commit %s into namespace %s", previews.ShortCommit(o.commitSha(pr)), preview.Spec.Resources.Namespace)
+	defer func() {
+		o.recordDeploy(pr, startTime, envVars, err)
+	}()
 	if !o.NoWatchNamespace {
 		err = o.watchNamespaceStart()
 		if err != nil {
@@ -188,8 +303,23 @@ func (o *Options) Run() error {
 		}
 	}
 
+	err = o.startPhase(lock, "deploy")
+	if err != nil {
+		return err
+	}
+	err = o.deployDependencies(envVars)
+	if err != nil {
+		return fmt.Errorf("failed to deploy the preview dependencies: %w", err)
+	}
+
 	err = o.helmfileSyncPreview(envVars)
 	if err != nil {
+		if o.RollbackOnFailure {
+			rollbackErr := o.rollbackPreview(pr, err)
+			if rollbackErr != nil {
+				return fmt.Errorf("failed to helmfile sync: %w: %w", err, rollbackErr)
+			}
+		}
 		return fmt.Errorf("failed to helmfile sync: %w", err)
 	}
 
@@ -200,52 +330,136 @@ func (o *Options) Run() error {
 		}
 	}
 
+	err = o.startPhase(lock, "tls")
+	if err != nil {
+		return err
+	}
+	tlsHosts, err := o.ensureTLS()
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS for the preview: %w", err)
+	}
+
+	err = o.startPhase(lock, "auth")
+	if err != nil {
+		return err
+	}
+	credentials, err := previews.ProtectIngresses(o.KubeClient, preview.Spec.Resources.Namespace, o.Config.Auth)
+	if err != nil {
+		return fmt.Errorf("failed to protect the preview: %w", err)
+	}
+	if credentials != nil {
+		log.Logger().Infof("preview %s is protected by basic authentication with the credentials in Secret %s in namespace %s", info(preview.Name), info(previews.AuthSecretName), info(preview.Spec.Resources.Namespace))
+	}
+
+	err = o.startPhase(lock, "urls")
+	if err != nil {
+		return err
+	}
 	url, err := o.findPreviewURL(envVars)
 	if err != nil {
 		log.Logger().Warnf("failed to detect the preview URL %+v", err)
 	}
+	urls, err := o.URLFinder.FindURLs(ctx, preview.Spec.Resources.Namespace)
+	if err != nil {
+		log.Logger().Warnf("failed to detect all the preview URLs %+v", err)
+	}
+	if url == "" && len(urls) > 0 {
+		url = urls[0].URL
+	}
+	urls = o.tagKnativeRevisions(pr, preview.Spec.Resources.Namespace, urls)
+	if len(tlsHosts) > 0 {
+		// only the Ingresses are configured for TLS
+		url = previews.ToHTTPS(url, tlsHosts)
+		for i := range urls {
+			if urls[i].Kind == previewurls.KindIngress {
+				urls[i].URL = previews.ToHTTPS(urls[i].URL, tlsHosts)
+			}
+		}
+	}
 
 	if url != "" && o.PreviewURLPath != "" {
 		url = stringhelpers.UrlJoin(url, o.PreviewURLPath)
 	}
 
-	toAuthor(&preview.Spec.PullRequest.User, &pr.Author)
+	pullRequestURL := preview.Spec.PullRequest.URL
+	switch {
+	case o.linkedPreview != nil:
+		// the preview belongs to the linked pull request
+		pullRequestURL = pr.Link
+	case pr != nil:
+		toAuthor(&preview.Spec.PullRequest.User, &pr.Author)
+	}
 
 	o.OutputEnvVars["PREVIEW_URL"] = url
 	o.OutputEnvVars["PREVIEW_NAME"] = preview.Name
 	o.OutputEnvVars["PREVIEW_NAMESPACE"] = preview.Spec.Resources.Namespace
-	o.OutputEnvVars["PREVIEW_PULL_REQUEST_URL"] = preview.Spec.PullRequest.URL
+	o.OutputEnvVars["PREVIEW_PULL_REQUEST_URL"] = pullRequestURL
+	for k, v := range previewurls.EnvVars(urls) {
+		o.OutputEnvVars[k] = v
+	}
 
 	if url != "" {
 		log.Logger().Infof("preview %s is now running at %s", info(preview.Name), info(url))
 
-		// let's modify the preview
-		preview.Spec.Resources.Name = o.Repository
-		preview.Spec.Resources.URL = url
-		preview, err = o.PreviewClient.PreviewV1alpha1().Previews(o.Namespace).Update(ctx, preview, metav1.UpdateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to update preview %s: %w", preview.Name, err)
+		if o.linkedPreview == nil {
+			// let's apply the deployed resources of the preview
+			err = o.startPhase(lock, "update")
+			if err != nil {
+				return err
+			}
+			applied := &v1alpha1.Preview{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      preview.Name,
+					Namespace: preview.Namespace,
+				},
+			}
+			applied.Spec.Resources = v1alpha1.Resources{
+				Name:      o.Repository,
+				URL:       url,
+				Namespace: preview.Spec.Resources.Namespace,
+				URLs:      urls,
+			}
+			applied.Spec.PullRequest.User = preview.Spec.PullRequest.User
+			preview, err = previews.ApplyPreview(o.PreviewClient, applied, previews.ResourcesFieldManager)
+			if err != nil {
+				return fmt.Errorf("failed to update preview %s: %w", applied.Name, err)
+			}
+			log.Logger().Infof("updated preview %s with URL %s", preview.Name, url)
 		}
-		log.Logger().Infof("updated preview %s with URL %s", preview.Name, url)
 	} else {
 		log.Logger().Infof("could not detect a preview URL")
 	}
 
-	o.updatePipelineActivity(url, preview.Spec.PullRequest.URL)
+	o.updatePipelineActivity(url, pullRequestURL)
 
 	err = common.WriteOutputEnvVars(o.Dir, o.OutputEnvVars)
 	if err != nil {
 		return fmt.Errorf("failed to write output environment variables: %w", err)
 	}
 
-	if o.NoComment {
+	if o.NoComment || o.BranchPreview {
 		return nil
 	}
 
+	err = o.startPhase(lock, "comment")
+	if err != nil {
+		return err
+	}
 	comment := fmt.Sprintf(":star: PR built and available in a preview **%s**", preview.Name)
 	if url != "" {
 		comment += fmt.Sprintf(" [here](%s) ", url)
 	}
+	if len(urls) > 1 {
+		comment += "\n"
+		for i := range urls {
+			comment += fmt.Sprintf("\n* %s: [%s](%s)", urls[i].Name, urls[i].URL, urls[i].URL)
+		}
+	}
+	if credentials != nil {
+		comment += fmt.Sprintf("\n\n:lock: the preview is protected by basic authentication. Username: `%s` Password: `%s`", credentials.Username, credentials.Password)
+	} else if o.Config.Auth.GetMode() == previewconfig.AuthModeExternal {
+		comment += "\n\n:lock: sign in to view the preview"
+	}
 
 	return o.commentOnPullRequest(comment)
 }
@@ -270,12 +484,25 @@ func (o *Options) Validate() error {
 	if o.CommandRunner == nil {
 		o.CommandRunner = cmdrunner.QuietCommandRunner
 	}
+	o.CommandRunner = o.traceCommands(o.CommandRunner)
 	if o.GitClient == nil {
 		o.GitClient = cli.NewCLIClient("", o.CommandRunner)
 	}
-	err := o.PullRequestOptions.Validate()
-	if err != nil {
-		return fmt.Errorf("failed to validate repository options: %w", err)
+	var err error
+	if o.BranchPreview {
+		// branch previews have no pull request to discover
+		err = o.PullRequestOptions.Options.Validate()
+		if err != nil {
+			return fmt.Errorf("failed to validate repository options: %w", err)
+		}
+		if o.Branch == "" || o.Branch == "HEAD" {
+			return options.MissingOption("branch")
+		}
+	} else {
+		err = o.PullRequestOptions.Validate()
+		if err != nil {
+			return fmt.Errorf("failed to validate repository options: %w", err)
+		}
 	}
 
 	err = o.DiscoverPreviewHelmfile()
@@ -292,15 +519,67 @@ func (o *Options) Validate() error {
 	if err != nil {
 		return fmt.Errorf("failed to create kube client: %w", err)
 	}
+	o.DynamicClient, err = previews.LazyCreateDynamicClient(o.DynamicClient)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	o.EventRecorder = previews.LazyCreateEventRecorder(o.EventRecorder, o.KubeClient)
 	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
 	if err != nil {
 		return fmt.Errorf("failed to create jx client: %w", err)
 	}
 
+	if o.Config == nil {
+		o.Config, err = previewconfig.LoadConfig(o.KubeClient, o.Namespace)
+		if err != nil {
+			return fmt.Errorf("failed to load the preview configuration: %w", err)
+		}
+	}
+	o.Config, err = previewconfig.LoadRepositoryConfig(o.Config, filepath.Dir(o.PreviewHelmfile))
+	if err != nil {
+		return fmt.Errorf("failed to load the preview configuration of the repository: %w", err)
+	}
+	o.Notifier = notify.LazyCreateNotifier(o.Notifier, o.KubeClient, o.Namespace, o.Config)
+	if o.AuthMode != "" {
+		auth := &previewconfig.Auth{}
+		if o.Config.Auth != nil {
+			*auth = *o.Config.Auth
+		}
+		auth.Mode = previewconfig.AuthMode(o.AuthMode)
+		o.Config.Auth = auth
+		err = o.Config.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid auth options: %w", err)
+		}
+	}
+	if o.TLS || o.TLSIssuer != "" || o.TLSSecret != "" {
+		tls := &previewconfig.TLS{}
+		if o.Config.TLS != nil {
+			*tls = *o.Config.TLS
+		}
+		tls.Enabled = true
+		if o.TLSIssuer != "" {
+			tls.Issuer = o.TLSIssuer
+			tls.IssuerKind = previewconfig.IssuerKindClusterIssuer
+		}
+		if o.TLSSecret != "" {
+			tls.SecretName = o.TLSSecret
+			tls.SecretNamespace = ""
+		}
+		o.Config.TLS = tls
+		err = o.Config.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid TLS options: %w", err)
+		}
+	}
+
 	o.KServeClient, err = kserving.LazyCreateKServeClient(o.KServeClient)
 	if err != nil {
 		return fmt.Errorf("failed to create jx client: %w", err)
 	}
+	if o.URLFinder == nil {
+		o.URLFinder = previewurls.NewDefaultFinder(o.KubeClient, o.DynamicClient, o.KServeClient)
+	}
 
 	if o.PreviewNamespace == "" {
 		o.PreviewNamespace, err = o.createPreviewNamespace()
@@ -385,6 +664,54 @@ func (o *Options) helmfileSyncPreview(envVars map[string]string) error {
 	return nil
 }
 
+// deployDependencies deploys the dependencies declared in the preview helmfile at the versions promoted to their environments
+func (o *Options) deployDependencies(envVars map[string]string) error {
+	dependencies, err := helmfiles.LoadDependencies(o.PreviewHelmfile)
+	if err != nil {
+		return fmt.Errorf("failed to load the dependencies of the preview: %w", err)
+	}
+	if len(dependencies) == 0 {
+		return nil
+	}
+	jxValuesFile, err := filepath.Abs(filepath.Join(filepath.Dir(o.PreviewHelmfile), "jx-values.yaml"))
+	if err != nil {
+		return fmt.Errorf("failed to find the jx-values.yaml file of the preview: %w", err)
+	}
+	helmfile, err := previews.ResolveDependencies(o.GitClient, o.JXClient, o.Namespace, envVars["PREVIEW_NAMESPACE"], jxValuesFile, o.GitUser, o.GitToken, dependencies)
+	if err != nil {
+		return fmt.Errorf("failed to resolve dependencies: %w", err)
+	}
+
+	// the generated helmfile is kept out of the working tree of the repository
+	dir, err := os.MkdirTemp("", "jx-preview-dependencies-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, previews.DependenciesHelmfileName)
+	err = helmfiles.SaveHelmfile(file, helmfile)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"--file", file}
+	if o.Debug {
+		args = append(args, "--debug")
+	}
+	for _, command := range []string{"repos", "sync"} {
+		c := &cmdrunner.Command{
+			Name: "helmfile",
+			Args: append(args, command),
+			Env:  envVars,
+		}
+		_, err = o.CommandRunner(c)
+		if err != nil {
+			return fmt.Errorf("failed to run helmfile %s on %s: %w", command, file, err)
+		}
+	}
+	return nil
+}
+
 func (o *Options) ProcessHelmfileSyncTimeoutOrReturnOriginalError(syncError error) error {
 	if timedOut.MatchString(syncError.Error()) {
 		log.Logger().Infof("detected a failure on the preview environment %s so looking for an erroring pod", o.PreviewNamespace)
@@ -470,22 +797,73 @@ func (o *Options) CreateHelmfileEnvVars(fn func(string) (string, error)) (map[st
 }
 
 func (o *Options) createPreviewNamespace() (string, error) {
-	prefix := o.Namespace + "-"
-	prName := o.Owner + "-" + o.Repository + "-pr-" + strconv.Itoa(o.Number)
+	// existing previews keep their namespace even if the naming template changes
+	var preview *v1alpha1.Preview
+	var err error
+	if o.BranchPreview {
+		preview, err = previews.FindBranchPreview(o.PreviewClient, o.Namespace, o.Owner, o.Repository, o.Branch)
+	} else {
+		preview, err = previews.FindPullRequestPreview(o.PreviewClient, o.Namespace, o.Owner, o.Repository, o.Number)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find the existing Preview: %w", err)
+	}
+	if preview != nil && preview.Spec.Resources.Namespace != "" {
+		return preview.Spec.Resources.Namespace, nil
+	}
+	if o.BranchPreview {
+		data := previews.NewNamespaceNameData(o.Namespace, o.Owner, o.Repository, 0, o.Branch)
+		return previews.NamespaceName(o.PreviewClient, o.Config.BranchNamespaceTemplate, data)
+	}
+	data := previews.NewNamespaceNameData(o.Namespace, o.Owner, o.Repository, o.Number, o.Branch)
+	return previews.NamespaceName(o.PreviewClient, o.Config.NamespaceTemplate, data)
+}
 
-	prNamespace := prefix + prName
-	if len(prNamespace) > 63 {
-		maxIndex := 62 - len(prefix)
-		size := len(prName)
+// upsertPreview creates or updates the Preview resource for the pull request or the branch if pr is nil
+func (o *Options) upsertPreview(pr *scm.PullRequest, destroyCmd *v1alpha1.Command, previewNamespace string) (*v1alpha1.Preview, error) {
+	if pr != nil {
+		if o.linkedPreview != nil {
+			// the releases of this pull request are removed along with the namespace of the linked preview
+			return previews.UpdateLinkedPullRequests(o.PreviewClient, o.Namespace, o.linkedPreview.Name, *toPullRequest(pr))
+		}
+		preview, _, err := previews.GetOrCreatePreview(o.PreviewClient, o.Namespace, pr, destroyCmd, pr.Repository().Link, previewNamespace, o.PreviewHelmfile)
+		if err != nil || len(o.links) == 0 {
+			return preview, err
+		}
+		return previews.UpdateLinkedPullRequests(o.PreviewClient, o.Namespace, preview.Name, o.links...)
+	}
+	branch := &v1alpha1.PreviewBranch{
+		Name: o.Branch,
+	}
+	if o.TTL > 0 {
+		branch.TTL = &metav1.Duration{Duration: o.TTL}
+	}
+	repoLink := strings.TrimSuffix(o.SourceURL, ".git")
+	preview, _, err := previews.GetOrCreateBranchPreview(o.PreviewClient, o.Namespace, o.Owner, o.Repository, branch, destroyCmd, o.SourceURL, repoLink, previewNamespace, o.PreviewHelmfile)
+	return preview, err
+}
 
-		prNamespace = prefix + prName[size-maxIndex:]
-		log.Logger().Warnf("Due the name of the organisation and repository being too long (%s) we are going to trim it to make the preview namespace: %s", prName, prNamespace)
+// ensureTLS configures TLS for the Ingresses of the preview and waits for any certificates issued by cert-manager.
+// Returns the hosts of the Ingresses served over TLS
+func (o *Options) ensureTLS() ([]string, error) {
+	cfg := o.Config.TLS
+	if !cfg.IsEnabled() {
+		return nil, nil
 	}
-	if len(prNamespace) > 63 {
-		return "", fmt.Errorf("preview namespace %s is too long. Must be no more than 63 character", prNamespace)
+	previewNamespace := o.Preview.Spec.Resources.Namespace
+	secretNames, tlsHosts, err := previews.ApplyIngressTLS(o.KubeClient, previewNamespace, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SecretName != "" {
+		// the wildcard certificate is not issued for the preview
+		return tlsHosts, nil
+	}
+	err = previews.WaitForCertificates(o.DynamicClient, previewNamespace, secretNames, o.TLSTimeout)
+	if err != nil {
+		return nil, err
 	}
-	prNamespace = naming.ToValidName(prNamespace)
-	return prNamespace, nil
+	return tlsHosts, nil
 }
 
 func findAllServiceNamesInNamespace(client kubernetes.Interface, namespace string) ([]string, error) {
@@ -629,7 +1007,7 @@ func (o *Options) commentOnPullRequest(comment string) error {
 
 	ctx := context.Background()
 	commentInput := &scm.CommentInput{
-		Body: comment,
+		Body: comment + o.traceComment(),
 	}
 	_, _, err := o.ScmClient.PullRequests.CreateComment(ctx, o.FullRepositoryName, o.Number, commentInput)
 	prName := "#" + strconv.Itoa(o.Number)
@@ -15,9 +15,12 @@ import (
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
 
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/fake"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/cmd/destroy"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/fakescms"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewurls"
 	"github.com/jenkins-x/go-scm/scm"
 	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
 	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
@@ -30,6 +33,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	nv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
 	fakekube "k8s.io/client-go/kubernetes/fake"
 	kservefake "knative.dev/serving/pkg/client/clientset/versioned/fake"
 
@@ -125,13 +131,20 @@ func AssertPreview(t *testing.T, customService string, failSync bool, podState c
 	ctx := context.Background()
 	previewName := ""
 	tmpDir := ""
-	for _, testName := range []string{"create", "update"} {
+	for i, testName := range []string{"create", "update"} {
 		_, o := create.NewCmdPreviewCreate()
 		o.GitUser = "fakeuser"
 		o.GitToken = "faketoken"
 		o.NoWatchNamespace = true
 		o.PreviewClient = previewClient
 		o.KubeClient = kubeClient
+		o.DynamicClient = dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+			previews.SecretsResource:    "SecretList",
+			previews.ConfigMapsResource: "ConfigMapList",
+			{Group: "external-secrets.io", Version: "v1beta1", Resource: "externalsecrets"}: "ExternalSecretList",
+			previewurls.RoutesResource:     "RouteList",
+			previewurls.HTTPRoutesResource: "HTTPRouteList",
+		})
 		o.JXClient = jxClient
 		o.KServeClient = kservefake.NewSimpleClientset()
 		o.Options.JXClient = jxClient
@@ -238,6 +251,9 @@ func AssertPreview(t *testing.T, customService string, failSync bool, podState c
 
 		assert.Equal(t, previewNamespace, preview.Spec.Resources.Namespace, "preview.Spec.Resources.Namespace")
 		assert.Equal(t, previewURL, preview.Spec.Resources.URL, "preview.Spec.Resources.URL")
+		require.Len(t, preview.Spec.Resources.URLs, 1, "preview.Spec.Resources.URLs")
+		assert.Equal(t, previewurls.KindIngress, preview.Spec.Resources.URLs[0].Kind, "preview.Spec.Resources.URLs[0].Kind")
+		assert.Equal(t, preview.Spec.Resources.URLs[0].URL, o.OutputEnvVars[previewurls.EnvVarName(preview.Spec.Resources.URLs[0].Name)], "named preview URL env var")
 
 		assert.NotEmpty(t, preview.Spec.DestroyCommand.Args, "preview.Spec.DestroyCommand.Names")
 		assert.NotEmpty(t, preview.Spec.DestroyCommand.Env, "preview.Spec.DestroyCommand.Env")
@@ -253,6 +269,13 @@ func AssertPreview(t *testing.T, customService string, failSync bool, podState c
 		prsrc := &preview.Spec.Source
 		assert.Equal(t, repoLink, prsrc.URL, "preview.Spec.Source.URL")
 		assert.Equal(t, sha, prsrc.Ref, "preview.Spec.Source.Ref")
+
+		require.Len(t, preview.Status.History, i+1, "preview.Status.History for test %s", testName)
+		deploy := preview.Status.History[i]
+		assert.Equal(t, v1alpha1.DeployOutcomeSucceeded, deploy.Outcome, "preview.Status.History[%d].Outcome", i)
+		assert.Equal(t, buildNumber, deploy.BuildNumber, "preview.Status.History[%d].BuildNumber", i)
+		assert.Equal(t, previewURL, deploy.URL, "preview.Status.History[%d].URL", i)
+		assert.NotNil(t, deploy.EndTime, "preview.Status.History[%d].EndTime", i)
 	}
 
 	// If the sync fails the pipeline wont be updated
@@ -0,0 +1,110 @@
+package create
+
+import (
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/notify"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordDeploy adds this deploy to the history of the preview unless it was deployed into the preview of a linked pull request
+func (o *Options) recordDeploy(pr *scm.PullRequest, startTime metav1.Time, envVars map[string]string, deployErr error) {
+	endTime := metav1.Now()
+	deploy := &v1alpha1.PreviewDeploy{
+		Commit:      o.commitSha(pr),
+		Version:     o.Version,
+		BuildNumber: o.BuildNumber,
+		StartTime:   startTime,
+		EndTime:     &endTime,
+		Outcome:     v1alpha1.DeployOutcomeSucceeded,
+		URL:         o.OutputEnvVars["PREVIEW_URL"],
+		Releases:    o.releaseRevisions(envVars),
+	}
+	commit := previews.ShortCommit(deploy.Commit)
+	eventType := notify.EventReady
+	message := ""
+	if deployErr != nil {
+		deploy.Outcome = v1alpha1.DeployOutcomeFailed
+		deploy.Message = deployErr.Error()
+		o.EventRecorder.Eventf(o.Preview, corev1.EventTypeWarning, previews.ReasonDeployFailed, "failed to deploy commit %s: %s", commit, deployErr.Error())
+		eventType = notify.EventFailed
+		message = deployErr.Error()
+		deploy.RolledBackReleases = o.rolledBackReleases
+		if o.rolledBackTo != nil {
+			deploy.RolledBackTo = o.rolledBackTo.Commit
+			deploy.URL = o.rolledBackTo.URL
+			o.EventRecorder.Eventf(o.Preview, corev1.EventTypeWarning, previews.ReasonRolledBack, "rolled back to commit %s", previews.ShortCommit(deploy.RolledBackTo))
+			eventType = notify.EventRolledBack
+			message = fmt.Sprintf("rolled back to commit %s: %s", previews.ShortCommit(deploy.RolledBackTo), deployErr.Error())
+		}
+	} else {
+		target := deploy.URL
+		if target == "" {
+			target = o.Preview.Spec.Resources.Namespace
+		}
+		o.EventRecorder.Eventf(o.Preview, corev1.EventTypeNormal, previews.ReasonDeployed, "deployed commit %s to %s", commit, target)
+	}
+
+	if o.linkedPreview != nil {
+		// the history of a linked preview is of the deploys of the pull request which owns it
+		log.Logger().Infof("not recording the deploy in the history of preview %s as it belongs to the linked pull request %s", info(o.Preview.Name), info(o.linkedPreview.Spec.PullRequest.URL))
+	} else {
+		preview, err := previews.RecordDeploy(o.PreviewClient, o.Namespace, o.Preview.Name, deploy)
+		if err != nil {
+			log.Logger().Warnf("%s", err.Error())
+		} else {
+			o.Preview = preview
+		}
+	}
+	o.sendNotification(eventType, deploy, message)
+}
+
+// sendNotification notifies the webhooks of the deploy logging rather than failing if they cannot be notified
+func (o *Options) sendNotification(eventType notify.EventType, deploy *v1alpha1.PreviewDeploy, message string) {
+	if o.Notifier == nil {
+		return
+	}
+	event := notify.NewEvent(eventType, o.Preview, message)
+	event.Commit = deploy.Commit
+	event.URL = deploy.URL
+	err := o.Notifier.Notify(event)
+	if err != nil {
+		log.Logger().Warnf("failed to notify the webhooks of preview %s: %s", o.Preview.Name, err.Error())
+	}
+}
+
+// releaseRevisions returns the current revisions of the helm releases of the preview
+func (o *Options) releaseRevisions(envVars map[string]string) []v1alpha1.ReleaseRevision {
+	releases, err := helmfiles.ListReleases(o.CommandRunner, o.PreviewHelmfile, envVars)
+	if err != nil {
+		log.Logger().Warnf("failed to list the releases of the preview: %s", err.Error())
+		return nil
+	}
+	var answer []v1alpha1.ReleaseRevision
+	for _, r := range releases {
+		if !r.Enabled || r.Name == "" {
+			continue
+		}
+		ns := r.Namespace
+		if ns == "" {
+			ns = o.PreviewNamespace
+		}
+		revision, err := helmfiles.GetReleaseRevision(o.CommandRunner, r.Name, ns)
+		if err != nil {
+			log.Logger().Debugf("failed to find the revision of release %s in namespace %s: %s", r.Name, ns, err.Error())
+			continue
+		}
+		answer = append(answer, v1alpha1.ReleaseRevision{
+			Name:      r.Name,
+			Namespace: ns,
+			Revision:  revision,
+		})
+	}
+	return answer
+}
@@ -0,0 +1,67 @@
+package create
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner/fakerunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordDeploy(t *testing.T) {
+	ns := "jx"
+	testCases := []struct {
+		name    string
+		linked  bool
+		history []string
+	}{
+		{
+			name:    "own",
+			history: []string{"c1", "c2"},
+		},
+		{
+			name:    "linked",
+			linked:  true,
+			history: []string{"c1"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			preview := &v1alpha1.Preview{ObjectMeta: metav1.ObjectMeta{Name: "jx-myowner-myrepo-pr-1", Namespace: ns}}
+			preview.Spec.PullRequest.URL = "https://github.com/myowner/myrepo/pull/1"
+			preview.Status.History = []v1alpha1.PreviewDeploy{{Commit: "c1", Outcome: v1alpha1.DeployOutcomeSucceeded}}
+			previewClient := fake.NewSimpleClientset(preview)
+			runner := &fakerunner.FakeRunner{}
+			o := &Options{
+				PreviewClient: previewClient,
+				CommandRunner: runner.Run,
+				EventRecorder: previews.NewEventRecorder(fakekube.NewSimpleClientset()),
+				Preview:       preview,
+			}
+			o.Namespace = ns
+			if tc.linked {
+				// the pull request was deployed into the preview of pull request 1
+				o.linkedPreview = preview
+			}
+
+			o.recordDeploy(&scm.PullRequest{Head: scm.PullRequestBranch{Sha: "c2"}}, metav1.Now(), nil, nil)
+			o.EventRecorder.Flush()
+
+			updated, err := previewClient.PreviewV1alpha1().Previews(ns).Get(context.Background(), preview.Name, metav1.GetOptions{})
+			require.NoError(t, err, "failed to get preview")
+			var commits []string
+			for _, d := range updated.Status.History {
+				commits = append(commits, d.Commit)
+			}
+			assert.Equal(t, tc.history, commits, "history commits")
+		})
+	}
+}
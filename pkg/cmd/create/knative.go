@@ -0,0 +1,66 @@
+package create
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/kserving"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewurls"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// tagKnativeRevisions waits for the revisions of the Knative Services created by this deploy and tags them with the
+// commit so that reviewers can see which commit they are looking at. The URLs of the tags are added to the URLs
+func (o *Options) tagKnativeRevisions(pr *scm.PullRequest, previewNamespace string, urls []v1alpha1.PreviewURL) []v1alpha1.PreviewURL {
+	var names []string
+	for i := range urls {
+		if urls[i].Kind == previewurls.KindKnativeService {
+			names = append(names, urls[i].Name)
+		}
+	}
+	if len(names) == 0 {
+		return urls
+	}
+
+	sha := o.commitSha(pr)
+	if sha == "" {
+		log.Logger().Warnf("cannot tag the knative revisions as the commit is unknown")
+		return urls
+	}
+	tag := kserving.CommitTag(sha)
+
+	ctx := context.Background()
+	for _, name := range names {
+		revision, tagURL, err := kserving.TagLatestRevision(ctx, o.KServeClient, o.KubeClient, previewNamespace, name, tag, o.PreviewURLTimeout)
+		if err != nil {
+			log.Logger().Warnf("failed to tag knative service %s: %s", name, err.Error())
+			continue
+		}
+		log.Logger().Infof("revision %s of knative service %s is available at %s", info(revision), info(name), info(tagURL))
+		urls = append(urls, v1alpha1.PreviewURL{
+			Name: name + "-" + tag,
+			URL:  tagURL,
+			Kind: previewurls.KindKnativeService,
+		})
+	}
+	previewurls.SortURLs(urls)
+	return urls
+}
+
+// commitSha returns the commit being deployed
+func (o *Options) commitSha(pr *scm.PullRequest) string {
+	if pr != nil {
+		if pr.Head.Sha != "" {
+			return pr.Head.Sha
+		}
+		return pr.Sha
+	}
+	sha, err := o.GitClient.Command(o.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		log.Logger().Warnf("failed to find the commit in %s: %s", o.Dir, err.Error())
+		return ""
+	}
+	return strings.TrimSpace(sha)
+}
@@ -0,0 +1,68 @@
+package create
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// linkPullRequests finds the pull requests linked via the --link-pr flag or directives in the pull request description.
+// If one of the linked pull requests already has a preview this pull request is deployed into the same preview namespace
+func (o *Options) linkPullRequests(pr *scm.PullRequest) error {
+	o.links = nil
+	for _, text := range o.LinkPullRequests {
+		link, err := previews.ParsePullRequestRef(text)
+		if err != nil {
+			return fmt.Errorf("invalid --link-pr value: %w", err)
+		}
+		o.links = append(o.links, *link)
+	}
+	directives, err := previews.ParseLinkDirectives(pr.Body)
+	if err != nil {
+		return fmt.Errorf("failed to parse the pull request description: %w", err)
+	}
+	o.links = append(o.links, directives...)
+
+	// a pull request which already has its own preview keeps it
+	current := toPullRequest(pr)
+	own, err := previews.FindPullRequestPreview(o.PreviewClient, o.Namespace, current.Owner, current.Repository, current.Number)
+	if err != nil {
+		return fmt.Errorf("failed to find the existing Preview: %w", err)
+	}
+	if own != nil {
+		return nil
+	}
+
+	resourceList, err := o.PreviewClient.PreviewV1alpha1().Previews(o.Namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Previews in namespace %s: %w", o.Namespace, err)
+	}
+	linked := previews.FindLinkedPreview(resourceList.Items, current, o.links)
+	if linked == nil || linked.Spec.Resources.Namespace == "" {
+		return nil
+	}
+	log.Logger().Infof("deploying into the preview %s of linked pull request %s", info(linked.Name), info(linked.Spec.PullRequest.URL))
+	o.linkedPreview = linked
+	o.PreviewNamespace = linked.Spec.Resources.Namespace
+	return nil
+}
+
+// toPullRequest converts the pull request into the form stored in a Preview
+func toPullRequest(pr *scm.PullRequest) *v1alpha1.PullRequest {
+	repo := pr.Repository()
+	answer := &v1alpha1.PullRequest{
+		Number:       pr.Number,
+		Owner:        repo.Namespace,
+		Repository:   repo.Name,
+		URL:          pr.Link,
+		Title:        pr.Title,
+		LatestCommit: pr.Head.Sha,
+	}
+	toAuthor(&answer.User, &pr.Author)
+	return answer
+}
@@ -0,0 +1,56 @@
+package create
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// lockPreview takes the lock of the preview namespace so that concurrent runs do not deploy into it at the same time
+func (o *Options) lockPreview(pr *scm.PullRequest, previewNamespace string) (*previews.Lock, error) {
+	commit := o.commitSha(pr)
+	number, branch := o.Number, ""
+	if o.BranchPreview {
+		number, branch = 0, o.Branch
+	}
+	owner := previews.LockOwner{
+		Holder: previews.NewLockHolder(),
+		Commit: commit,
+		Source: previews.LockSource(o.Owner, o.Repository, number, branch),
+		Order:  o.commitOrder(commit),
+	}
+	return previews.AcquireLock(o.KubeClient, o.Namespace, previewNamespace, owner, previews.LockOptions{Timeout: o.LockTimeout})
+}
+
+// startPhase starts the next phase of the run unless the lock of the preview namespace was lost to another run
+func (o *Options) startPhase(lock *previews.Lock, name string) error {
+	err := lock.Err()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	o.phases.Start(name)
+	return nil
+}
+
+// commitOrder returns the commit time so that newer commits supersede older ones falling back to the build number
+func (o *Options) commitOrder(commit string) int64 {
+	if commit != "" {
+		text, err := o.GitClient.Command(o.Dir, "log", "-1", "--format=%ct", commit)
+		if err == nil {
+			order, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+			if err == nil {
+				return order
+			}
+		}
+		log.Logger().Debugf("failed to find the time of commit %s so using the build number to order runs", commit)
+	}
+	order, err := strconv.ParseInt(o.BuildNumber, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return order
+}
@@ -0,0 +1,27 @@
+package create
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// recordMetrics records the duration of the run along with the step which failed and exports the metrics
+func (o *Options) recordMetrics(start time.Time, step string, err error) {
+	if err != nil {
+		reason := step
+		if errors.Is(err, previews.ErrSuperseded) {
+			reason = "superseded"
+		}
+		metrics.Failures.WithLabelValues("create", reason).Inc()
+	}
+	metrics.CreateDuration.WithLabelValues(o.Owner, o.Repository, metrics.Outcome(err)).Observe(time.Since(start).Seconds())
+
+	exportErr := o.Metrics.Export(metrics.Default, "create")
+	if exportErr != nil {
+		log.Logger().Warnf("failed to export the preview metrics: %s", exportErr.Error())
+	}
+}
@@ -0,0 +1,122 @@
+package create
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/cmd/destroy"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/quotas"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// enforceQuotas checks a new preview fits within the configured quotas, either refusing to create the preview
+// or evicting the least recently updated previews depending on the quota policy. The pull request is nil for branch previews
+func (o *Options) enforceQuotas(pr *scm.PullRequest, previewName string) error {
+	q := &o.Config.Quotas
+	if !q.Enabled() {
+		return nil
+	}
+	ctx := context.Background()
+	resourceList, err := o.PreviewClient.PreviewV1alpha1().Previews(o.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Previews in namespace %s: %w", o.Namespace, err)
+	}
+	for k := range resourceList.Items {
+		if resourceList.Items[k].Name == previewName {
+			// quotas only apply to new previews
+			return nil
+		}
+	}
+
+	candidate := &v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      previewName,
+			Namespace: o.Namespace,
+		},
+		Spec: v1alpha1.PreviewSpec{
+			PullRequest: v1alpha1.PullRequest{
+				Owner:      o.Owner,
+				Repository: o.Repository,
+			},
+		},
+	}
+	if pr != nil {
+		repo := pr.Repository()
+		candidate.Spec.PullRequest = v1alpha1.PullRequest{
+			Number:     pr.Number,
+			Owner:      repo.Namespace,
+			Repository: repo.Name,
+			User: v1alpha1.UserSpec{
+				Username: pr.Author.Login,
+			},
+		}
+	}
+
+	violations := quotas.Violations(q, resourceList.Items, candidate)
+	if len(violations) == 0 {
+		return nil
+	}
+	var reasons []string
+	for i := range violations {
+		reasons = append(reasons, violations[i].String())
+	}
+	reason := strings.Join(reasons, " and ")
+
+	if !q.Evict() {
+		if !o.NoComment && pr != nil {
+			comment := fmt.Sprintf(":no_entry: the preview was not created as %s has been reached. Please close or merge other pull requests with previews or ask your administrator to increase the limit", reason)
+			err = o.commentOnPullRequest(comment)
+			if err != nil {
+				log.Logger().Warnf("failed to comment on the pull request: %s", err.Error())
+			}
+		}
+		return fmt.Errorf("cannot create preview %s as %s has been reached", previewName, reason)
+	}
+
+	evictions := quotas.Evictions(q, resourceList.Items, candidate)
+	if len(evictions) == 0 {
+		return fmt.Errorf("cannot create preview %s as %s has been reached and no preview can be evicted", previewName, reason)
+	}
+
+	_, do := destroy.NewCmdPreviewDestroy()
+	do.Namespace = o.Namespace
+	do.PreviewClient = o.PreviewClient
+	do.KubeClient = o.KubeClient
+	do.JXClient = o.JXClient
+	do.GitClient = o.GitClient
+	do.CommandRunner = o.CommandRunner
+	do.EventRecorder = o.EventRecorder
+	do.Tracer = o.Tracer
+	do.Notifier = o.Notifier
+	do.ParentSpan = o.currentSpan()
+	do.GitUser = o.GitUser
+	do.GitToken = o.GitToken
+	err = do.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate destroy options: %w", err)
+	}
+	defer func() {
+		if do.DevDir != "" {
+			err := os.RemoveAll(do.DevDir)
+			if err != nil {
+				log.Logger().Warnf("failed to remove %s: %s", do.DevDir, err)
+			}
+		}
+	}()
+	for _, p := range evictions {
+		log.Logger().Infof("evicting preview %s as %s has been reached", info(p.Name), reason)
+		o.EventRecorder.Eventf(p, corev1.EventTypeNormal, previews.ReasonEvicted, "evicted to make room for preview %s as %s has been reached", previewName, reason)
+		err = do.DestroyWithReason(p.Name, fmt.Sprintf("evicted to make room for preview %s as %s has been reached", previewName, reason))
+		if err != nil {
+			return fmt.Errorf("failed to evict preview %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
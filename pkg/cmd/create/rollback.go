@@ -0,0 +1,67 @@
+package create
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// rollbackPreview rolls the helm releases of the preview back to the revisions of its last successful deploy
+// and explains what happened on the pull request. All the releases are rolled back even if some fail so that
+// the releases which were rolled back can be recorded in the history of the preview
+func (o *Options) rollbackPreview(pr *scm.PullRequest, deployErr error) error {
+	if o.linkedPreview != nil {
+		// the releases in the history of a linked preview are those of the pull request which owns it
+		log.Logger().Warnf("cannot roll back preview %s as it belongs to the linked pull request %s", info(o.Preview.Name), info(o.linkedPreview.Spec.PullRequest.URL))
+		return nil
+	}
+	last := previews.LastSuccessfulDeploy(o.Preview)
+	if last == nil || len(last.Releases) == 0 {
+		log.Logger().Warnf("cannot roll back preview %s as it has no previous successful deploy", info(o.Preview.Name))
+		return nil
+	}
+
+	var errs []error
+	for _, r := range last.Releases {
+		log.Logger().Infof("rolling back release %s in namespace %s to revision %d", info(r.Name), info(r.Namespace), r.Revision)
+		err := helmfiles.RollbackRelease(o.CommandRunner, r.Name, r.Namespace, r.Revision)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to roll back release %s in namespace %s to revision %d: %w", r.Name, r.Namespace, r.Revision, err))
+			continue
+		}
+		o.rolledBackReleases = append(o.rolledBackReleases, r)
+	}
+	if len(errs) > 0 {
+		err := errors.Join(errs...)
+		log.Logger().Warnf("failed to roll back preview %s: %s", o.Preview.Name, err.Error())
+		return err
+	}
+	o.rolledBackTo = last
+	log.Logger().Infof("rolled back preview %s to commit %s", info(o.Preview.Name), info(previews.ShortCommit(last.Commit)))
+
+	if o.NoComment || o.BranchPreview {
+		return nil
+	}
+	err := o.commentOnPullRequest(rollbackComment(o.Preview.Name, o.commitSha(pr), last, deployErr))
+	if err != nil {
+		log.Logger().Warnf("failed to comment on the pull request: %s", err.Error())
+	}
+	return nil
+}
+
+func rollbackComment(name, commit string, last *v1alpha1.PreviewDeploy, deployErr error) string {
+	comment := fmt.Sprintf(":warning: failed to deploy commit %s to preview **%s** so it was rolled back to commit %s", previews.ShortCommit(commit), name, previews.ShortCommit(last.Commit))
+	if last.URL != "" {
+		comment += fmt.Sprintf(" which is available [here](%s)", last.URL)
+	}
+	comment += "\n\nThe preview is degraded until the next successful deploy."
+	if deployErr != nil {
+		comment += fmt.Sprintf("\n\n<details>\n<summary>Error</summary>\n\n```\n%s\n```\n</details>", deployErr.Error())
+	}
+	return comment
+}
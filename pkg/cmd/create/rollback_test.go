@@ -0,0 +1,104 @@
+package create
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner/fakerunner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRollbackPreview(t *testing.T) {
+	releases := []v1alpha1.ReleaseRevision{
+		{Name: "api", Namespace: "jx-myowner-myrepo-pr-1", Revision: 3},
+		{Name: "ui", Namespace: "jx-myowner-myrepo-pr-1", Revision: 5},
+	}
+	testCases := []struct {
+		name       string
+		failing    string
+		rolledBack []v1alpha1.ReleaseRevision
+	}{
+		{
+			name:       "all",
+			rolledBack: releases,
+		},
+		{
+			name:       "partial",
+			failing:    "api",
+			rolledBack: releases[1:],
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempted []string
+			runner := &fakerunner.FakeRunner{
+				CommandRunner: func(c *cmdrunner.Command) (string, error) {
+					attempted = append(attempted, c.Args[1])
+					if c.Args[1] == tc.failing {
+						return "", errors.New("timed out waiting for the condition")
+					}
+					return "", nil
+				},
+			}
+			preview := &v1alpha1.Preview{ObjectMeta: metav1.ObjectMeta{Name: "jx-myowner-myrepo-pr-1"}}
+			preview.Status.History = []v1alpha1.PreviewDeploy{
+				{Commit: "c1", Outcome: v1alpha1.DeployOutcomeSucceeded, Releases: releases},
+			}
+			o := &Options{
+				CommandRunner: runner.Run,
+				Preview:       preview,
+				NoComment:     true,
+			}
+
+			err := o.rollbackPreview(nil, errors.New("helmfile sync failed"))
+			assert.Equal(t, []string{"api", "ui"}, attempted, "every release should be rolled back")
+			assert.Equal(t, tc.rolledBack, o.rolledBackReleases, "rolled back releases")
+			if tc.failing == "" {
+				require.NoError(t, err, "failed to roll back")
+				require.NotNil(t, o.rolledBackTo, "rolled back to")
+				assert.Equal(t, "c1", o.rolledBackTo.Commit, "rolled back commit")
+				return
+			}
+			require.Error(t, err, "should fail if a release cannot be rolled back")
+			assert.Contains(t, err.Error(), "failed to roll back release api", "error")
+			assert.Nil(t, o.rolledBackTo, "a partially rolled back preview should not be rolled back to the previous deploy")
+		})
+	}
+}
+
+func TestRollbackLinkedPreview(t *testing.T) {
+	var attempted []string
+	runner := &fakerunner.FakeRunner{
+		CommandRunner: func(c *cmdrunner.Command) (string, error) {
+			attempted = append(attempted, c.Args[1])
+			return "", nil
+		},
+	}
+	// the preview of another pull request which this pull request was deployed into
+	preview := &v1alpha1.Preview{ObjectMeta: metav1.ObjectMeta{Name: "jx-myowner-other-pr-2"}}
+	preview.Spec.PullRequest.URL = "https://github.com/myowner/other/pull/2"
+	preview.Status.History = []v1alpha1.PreviewDeploy{
+		{
+			Commit:   "c1",
+			Outcome:  v1alpha1.DeployOutcomeSucceeded,
+			Releases: []v1alpha1.ReleaseRevision{{Name: "other", Namespace: "jx-myowner-other-pr-2", Revision: 3}},
+		},
+	}
+	o := &Options{
+		CommandRunner: runner.Run,
+		Preview:       preview,
+		linkedPreview: preview,
+		NoComment:     true,
+	}
+
+	err := o.rollbackPreview(nil, errors.New("helmfile sync failed"))
+	require.NoError(t, err, "failed to skip the roll back")
+	assert.Empty(t, attempted, "the releases of the linked pull request should not be rolled back")
+	assert.Empty(t, o.rolledBackReleases, "rolled back releases")
+	assert.Nil(t, o.rolledBackTo, "rolled back to")
+}
@@ -0,0 +1,89 @@
+package create
+
+import (
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// startTrace starts the span of the run if tracing is configured via the OpenTelemetry environment variables
+func (o *Options) startTrace() {
+	var err error
+	o.Tracer, err = tracing.LazyCreateTracer(o.Tracer)
+	if err != nil {
+		log.Logger().Warnf("failed to configure tracing so the preview will not be traced: %s", err.Error())
+	}
+	o.phases = tracing.NewPhases(o.Tracer.Start("create"))
+	if o.Tracer.Enabled() {
+		log.Logger().Infof("tracing the preview with trace ID %s", info(o.phases.Root().TraceID()))
+	}
+}
+
+// endTrace ends the span of the run and exports the spans
+func (o *Options) endTrace(err error) {
+	o.phases.End(err)
+	flushErr := o.Tracer.Flush()
+	if flushErr != nil {
+		log.Logger().Warnf("failed to export the preview trace: %s", flushErr.Error())
+	}
+}
+
+// traceAttributes attributes the span of the run with the repository and pull request of the preview
+func (o *Options) traceAttributes(pr *scm.PullRequest) {
+	if o.phases == nil || !o.Tracer.Enabled() {
+		return
+	}
+	attributes := []attribute.KeyValue{
+		attribute.String("vcs.owner.name", o.Owner),
+		attribute.String("vcs.repository.name", o.Repository),
+	}
+	if pr != nil {
+		attributes = append(attributes, attribute.Int("vcs.change.id", pr.Number), attribute.String("vcs.change.url", pr.Link))
+	}
+	if o.Branch != "" {
+		attributes = append(attributes, attribute.String("vcs.ref.head.name", o.Branch))
+	}
+	if commit := o.commitSha(pr); commit != "" {
+		attributes = append(attributes, attribute.String("vcs.ref.head.revision", commit))
+	}
+	o.phases.Root().SetAttributes(attributes...)
+}
+
+// traceCommands traces each command run in a span of the current phase passing the trace context to the command.
+// Commands which already have a trace context such as those run when destroying previews are traced by their caller
+func (o *Options) traceCommands(runner cmdrunner.CommandRunner) cmdrunner.CommandRunner {
+	if !o.Tracer.Enabled() {
+		return runner
+	}
+	return func(c *cmdrunner.Command) (string, error) {
+		if c.Env[tracing.EnvTraceParent] != "" {
+			return runner(c)
+		}
+		span := o.currentSpan().Start(c.Name, attribute.String("process.command_line", c.CLI()))
+		c.Env = tracing.InjectEnv(span, c.Env)
+		out, err := runner(c)
+		span.RecordError(err)
+		span.End()
+		return out, err
+	}
+}
+
+// currentSpan returns the span of the current phase of the run or nil if it is not traced
+func (o *Options) currentSpan() *tracing.Span {
+	if o.phases == nil {
+		return nil
+	}
+	return o.phases.Span()
+}
+
+// traceComment returns the trace ID to add to pull request comments if the run is traced
+func (o *Options) traceComment() string {
+	if o.phases == nil || o.phases.Root().TraceID() == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n:mag: trace ID `%s`", o.phases.Root().TraceID())
+}
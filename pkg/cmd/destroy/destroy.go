@@ -2,9 +2,13 @@ package destroy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
 
@@ -14,8 +18,11 @@ import (
 
 	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/notify"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
 	jxc "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
@@ -29,6 +36,8 @@ import (
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -58,13 +67,22 @@ type Options struct {
 	GitUser            string // Only used for tests
 	FailOnHelmError    bool
 	SelectAll          bool
+	LockTimeout        time.Duration
 	PreviewClient      versioned.Interface
 	KubeClient         kubernetes.Interface
 	JXClient           jxc.Interface
 	GitClient          gitclient.Interface
 	CommandRunner      cmdrunner.CommandRunner
+	EventRecorder      previews.EventRecorder
+	Metrics            metrics.Options
+	Tracer             *tracing.Tracer
+	ParentSpan         *tracing.Span
+	Notifier           notify.Notifier
 	Input              input.Interface
 	DevDir             string
+
+	// devDirLock guards DevDir and the clone in it when previews are destroyed concurrently
+	devDirLock sync.Mutex
 }
 
 // NewCmdPreviewDestroy creates a command object for the command
@@ -86,7 +104,9 @@ func NewCmdPreviewDestroy() (*cobra.Command, *Options) {
 	cmd.Flags().StringVarP(&o.Filter, "filter", "", "", "The filter to use to find previews to delete")
 	cmd.Flags().StringVarP(&o.Dir, "dir", "", "", "The directory where to run the delete preview command - a git clone will be done on a temporary jx-git-xxx directory if this parameter is empty")
 	cmd.Flags().BoolVarP(&o.SelectAll, "all", "", false, "Select all the previews that match filter by default")
+	cmd.Flags().DurationVarP(&o.LockTimeout, "lock-timeout", "", previews.DefaultLockTimeout, "Time to wait for runs deploying into the preview namespace to finish")
 	cmd.Flags().BoolVarP(&o.FailOnHelmError, "fail-on-helm", "", false, "If enabled do not try to remove the namespace or Preview resource if we fail to destroy helmfile resources")
+	o.Metrics.AddFlags(cmd)
 	return cmd, o
 }
 
@@ -96,6 +116,9 @@ func (o *Options) Run() error {
 	if err != nil {
 		return fmt.Errorf("failed to validate options: %w", err)
 	}
+	defer o.EventRecorder.Flush()
+	defer o.ExportMetrics("destroy")
+	defer o.FlushTrace()
 
 	if len(o.Names) == 0 && !o.BatchMode {
 		ctx := context.Background()
@@ -144,7 +167,22 @@ func (o *Options) Run() error {
 
 // Destroy destroys a preview environment
 func (o *Options) Destroy(name string) error {
+	return o.DestroyWithReason(name, "")
+}
+
+// DestroyWithReason destroys a preview environment including why it was destroyed in the notifications
+func (o *Options) DestroyWithReason(name, reason string) (err error) {
 	ns := o.Namespace
+	start := time.Now()
+	phases := tracing.NewPhases(o.startSpan("destroy", attribute.String("jx.preview.name", name)))
+	superseded := false
+	defer func() {
+		phases.End(err)
+		if !superseded {
+			recordMetrics(start, phases.Name(), err)
+		}
+	}()
+	phases.Start("find")
 
 	log.Logger().Infof("destroying preview: %s in namespace %s", info(name), info(ns))
 
@@ -155,6 +193,36 @@ func (o *Options) Destroy(name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to find preview %s in namespace %s: %w", name, ns, err)
 	}
+	phases.Root().SetAttributes(traceAttributes(preview)...)
+
+	// lets wait for any runs deploying into the preview namespace
+	branch := ""
+	if preview.Spec.Branch != nil {
+		branch = preview.Spec.Branch.Name
+	}
+	pr := &preview.Spec.PullRequest
+	owner := previews.LockOwner{
+		Holder: previews.NewLockHolder(),
+		Source: previews.LockSource(pr.Owner, pr.Repository, pr.Number, branch),
+		Order:  math.MaxInt64,
+	}
+	phases.Start("lock")
+	lock, err := previews.AcquireLock(o.KubeClient, ns, preview.Spec.Resources.Namespace, owner, previews.LockOptions{Timeout: o.LockTimeout})
+	if err != nil {
+		if errors.Is(err, previews.ErrSuperseded) {
+			log.Logger().Infof("preview %s is already being destroyed", info(name))
+			superseded = true
+			return nil
+		}
+		return fmt.Errorf("failed to lock preview namespace %s: %w", preview.Spec.Resources.Namespace, err)
+	}
+	defer func() {
+		releaseErr := lock.Release()
+		if releaseErr != nil {
+			log.Logger().Warnf("failed to release the lock of preview %s: %s", name, releaseErr.Error())
+		}
+	}()
+	o.EventRecorder.Eventf(preview, corev1.EventTypeNormal, previews.ReasonDestroying, "destroying preview namespace %s", preview.Spec.Resources.Namespace)
 
 	if preview.Spec.DestroyCommand.Command != "" {
 		previewNamespace := preview.Spec.Resources.Namespace
@@ -163,6 +231,10 @@ func (o *Options) Destroy(name string) error {
 		if previewPath == "" {
 			previewPath = "preview"
 		}
+		err = startPhase(phases, lock, "clone")
+		if err != nil {
+			return err
+		}
 		dir := o.Dir
 		if dir == "" {
 			dir, err = o.gitCloneSource(preview, previewPath)
@@ -179,14 +251,19 @@ func (o *Options) Destroy(name string) error {
 		}
 
 		if exists {
-			o.DevDir, err = previews.CreateJXValuesFileWithCloneDir(o.GitClient, o.JXClient, o.Namespace, fullPreviewPath, previewNamespace, o.GitUser, o.GitToken, o.DevDir)
+			err = o.createJXValuesFile(fullPreviewPath, previewNamespace)
 			if err != nil {
 				log.Logger().WithError(err).Warnf("failed to create the jx-values.yaml file")
 			}
 		}
 
-		err = o.runDeletePreviewCommand(preview, dir)
+		err = startPhase(phases, lock, "resources")
+		if err != nil {
+			return err
+		}
+		err = o.runDeletePreviewCommand(phases.Span(), preview, dir)
 		if err != nil {
+			o.EventRecorder.Eventf(preview, corev1.EventTypeWarning, previews.ReasonDestroyFailed, "failed to delete the preview resources: %s", err.Error())
 			if o.FailOnHelmError {
 				return fmt.Errorf("failed to delete preview resources: %w", err)
 			}
@@ -194,19 +271,62 @@ func (o *Options) Destroy(name string) error {
 		}
 	}
 
+	err = startPhase(phases, lock, "namespace")
+	if err != nil {
+		return err
+	}
 	err = o.deletePreviewNamespace(preview)
 	if err != nil {
+		o.EventRecorder.Eventf(preview, corev1.EventTypeWarning, previews.ReasonDestroyFailed, "failed to delete the preview namespace: %s", err.Error())
 		return fmt.Errorf("failed to delete preview namespace: %w", err)
 	}
 
+	err = startPhase(phases, lock, "delete")
+	if err != nil {
+		return err
+	}
 	err = previewInterface.Delete(ctx, name, metav1.DeleteOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to delete preview %s in namespace %s: %w", name, ns, err)
 	}
+	o.EventRecorder.Eventf(preview, corev1.EventTypeNormal, previews.ReasonDestroyed, "destroyed preview namespace %s", preview.Spec.Resources.Namespace)
+	o.NotifyDestroyed(preview, reason)
 	log.Logger().Infof("deleted preview: %s in namespace %s", info(name), info(ns))
 	return nil
 }
 
+// createJXValuesFile creates the jx-values.yaml file in the preview directory from the clone of the dev environment
+// in DevDir. The clone is shared by the previews destroyed concurrently so it is locked for as long as it is used
+func (o *Options) createJXValuesFile(previewDir, previewNamespace string) error {
+	o.devDirLock.Lock()
+	defer o.devDirLock.Unlock()
+
+	var err error
+	o.DevDir, err = previews.CreateJXValuesFileWithCloneDir(o.GitClient, o.JXClient, o.Namespace, previewDir, previewNamespace, o.GitUser, o.GitToken, o.DevDir)
+	return err
+}
+
+// startPhase starts the next phase of destroying the preview unless the lock of the preview namespace was lost to another run
+func startPhase(phases *tracing.Phases, lock *previews.Lock, name string) error {
+	err := lock.Err()
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	phases.Start(name)
+	return nil
+}
+
+// NotifyDestroyed notifies the webhooks that the preview was destroyed logging rather than failing if they cannot be notified
+func (o *Options) NotifyDestroyed(preview *v1alpha1.Preview, reason string) {
+	if o.Notifier == nil {
+		return
+	}
+	err := o.Notifier.Notify(notify.NewEvent(notify.EventDestroyed, preview, reason))
+	if err != nil {
+		log.Logger().Warnf("failed to notify the webhooks of preview %s: %s", preview.Name, err.Error())
+	}
+}
+
 // Validate validates the inputs are valid
 func (o *Options) Validate() error {
 	err := o.BaseOptions.Validate()
@@ -229,6 +349,12 @@ func (o *Options) Validate() error {
 	if err != nil {
 		return fmt.Errorf("failed to create jx client: %w", err)
 	}
+	o.EventRecorder = previews.LazyCreateEventRecorder(o.EventRecorder, o.KubeClient)
+	o.Notifier = notify.LazyCreateNotifier(o.Notifier, o.KubeClient, o.Namespace, nil)
+	o.Tracer, err = tracing.LazyCreateTracer(o.Tracer)
+	if err != nil {
+		log.Logger().Warnf("failed to configure tracing so previews will not be traced: %s", err.Error())
+	}
 
 	if o.CommandRunner == nil {
 		o.CommandRunner = cmdrunner.QuietCommandRunner
@@ -239,7 +365,7 @@ func (o *Options) Validate() error {
 	return nil
 }
 
-func (o *Options) runDeletePreviewCommand(preview *v1alpha1.Preview, dir string) error {
+func (o *Options) runDeletePreviewCommand(span *tracing.Span, preview *v1alpha1.Preview, dir string) error {
 	destroyCmd := preview.Spec.DestroyCommand
 
 	envVars := map[string]string{}
@@ -256,7 +382,7 @@ func (o *Options) runDeletePreviewCommand(preview *v1alpha1.Preview, dir string)
 		Dir:  dir,
 		Env:  envVars,
 	}
-	_, err := o.CommandRunner(c)
+	_, err := o.runTracedCommand(span, c)
 	if err != nil {
 		return fmt.Errorf("failed to run destroy command: %w", err)
 	}
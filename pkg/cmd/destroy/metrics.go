@@ -0,0 +1,24 @@
+package destroy
+
+import (
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// recordMetrics records the duration of destroying a preview along with the step which failed
+func recordMetrics(start time.Time, step string, err error) {
+	if err != nil {
+		metrics.Failures.WithLabelValues("destroy", step).Inc()
+	}
+	metrics.DestroyDuration.WithLabelValues(metrics.Outcome(err)).Observe(time.Since(start).Seconds())
+}
+
+// ExportMetrics exports the metrics of the command logging rather than failing if they cannot be exported
+func (o *Options) ExportMetrics(command string) {
+	err := o.Metrics.Export(metrics.Default, command)
+	if err != nil {
+		log.Logger().Warnf("failed to export the preview metrics: %s", err.Error())
+	}
+}
@@ -0,0 +1,52 @@
+package destroy
+
+import (
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// startSpan starts a span as a child of the ParentSpan if there is one such as when destroying previews during gc
+func (o *Options) startSpan(name string, attributes ...attribute.KeyValue) *tracing.Span {
+	if o.ParentSpan != nil {
+		return o.ParentSpan.Start(name, attributes...)
+	}
+	return o.Tracer.Start(name, attributes...)
+}
+
+// runTracedCommand runs the command in a child span of the span passing the trace context to the command
+func (o *Options) runTracedCommand(span *tracing.Span, c *cmdrunner.Command) (string, error) {
+	span = span.Start(c.Name, attribute.String("process.command_line", c.CLI()))
+	c.Env = tracing.InjectEnv(span, c.Env)
+	out, err := o.CommandRunner(c)
+	span.RecordError(err)
+	span.End()
+	return out, err
+}
+
+// FlushTrace exports the spans logging rather than failing if they cannot be exported
+func (o *Options) FlushTrace() {
+	err := o.Tracer.Flush()
+	if err != nil {
+		log.Logger().Warnf("failed to export the preview trace: %s", err.Error())
+	}
+}
+
+// traceAttributes returns the attributes of the repository and pull request of the preview
+func traceAttributes(preview *v1alpha1.Preview) []attribute.KeyValue {
+	pr := &preview.Spec.PullRequest
+	attributes := []attribute.KeyValue{
+		attribute.String("vcs.owner.name", pr.Owner),
+		attribute.String("vcs.repository.name", pr.Repository),
+		attribute.String("k8s.namespace.name", preview.Spec.Resources.Namespace),
+	}
+	if pr.Number > 0 {
+		attributes = append(attributes, attribute.Int("vcs.change.id", pr.Number), attribute.String("vcs.change.url", pr.URL))
+	}
+	if pr.LatestCommit != "" {
+		attributes = append(attributes, attribute.String("vcs.ref.head.revision", pr.LatestCommit))
+	}
+	return attributes
+}
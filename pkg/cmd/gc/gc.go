@@ -2,20 +2,31 @@ package gc
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/cmd/destroy"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/quotas"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/rootcmd"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
 	"github.com/jenkins-x/go-scm/scm"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/scmhelpers"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/spf13/cobra"
+	"go.opentelemetry.io/otel/attribute"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
@@ -25,9 +36,33 @@ import (
 type Options struct {
 	destroy.Options
 
-	Deleted       []string
-	DestroyDrafts bool
-	DryRun        bool
+	Deleted            []string
+	OrphanedNamespaces []string
+	DanglingPreviews   []string
+	Evicted            []string
+	Failures           []Failure
+	DestroyDrafts      bool
+	DryRun             bool
+	NoOrphans          bool
+	Parallelism        int
+	MaxFailures        int
+	RateLimitTimeout   time.Duration
+	OrphanGracePeriod  time.Duration
+	BranchTTL          time.Duration
+
+	Config       *previewconfig.Config
+	pullRequests *pullRequestCache
+}
+
+// Failure a preview which could not be garbage collected
+type Failure struct {
+	Name  string
+	Error error
+}
+
+type gcResult struct {
+	deleted bool
+	err     error
 }
 
 var (
@@ -37,12 +72,30 @@ var (
 		If a pull request is merged or closed the associated preview
 		environment will be deleted.
 
+		Previews with linked pull requests are only deleted once all of
+		the linked pull requests are also merged or closed.
+
+		Branch previews are deleted when their branch or tag is removed
+		or their TTL expires.
+
+		Preview namespaces whose Preview was removed and Previews whose
+		namespace no longer exists are also deleted.
+
+		If preview quotas are configured the least recently updated
+		previews are deleted until the quotas are no longer exceeded.
+
+		A failure to garbage collect one preview does not stop the others
+		from being processed. All failures are reported at the end and
+		previews which keep failing are labelled so they can be found.
+
 `)
 
 	cmdExample = templates.Examples(`
 		# garbage collect previews
 		%s gc
 `)
+
+	info = termcolor.ColorInfo
 )
 
 func NewCmdGCPreviews() (*cobra.Command, *Options) {
@@ -60,16 +113,36 @@ func NewCmdGCPreviews() (*cobra.Command, *Options) {
 	}
 	cmd.Flags().BoolVarP(&options.DestroyDrafts, "gc-drafts", "", false, "Also garbage collect drafts")
 	cmd.Flags().BoolVarP(&options.DryRun, "dry-run", "", false, "Don't garbage collect, just display which would be deleted")
+	cmd.Flags().BoolVarP(&options.NoOrphans, "no-orphans", "", false, "Disables garbage collecting preview namespaces without a Preview and Previews without a preview namespace")
+	cmd.Flags().DurationVarP(&options.OrphanGracePeriod, "orphan-grace-period", "", time.Hour, "The minimum age of a preview namespace or Preview before it can be garbage collected as an orphan")
+	cmd.Flags().DurationVarP(&options.BranchTTL, "branch-ttl", "", 0, "How long branch previews without their own TTL are kept after they were last updated. If not specified they are kept until the branch is removed")
+	cmd.Flags().IntVarP(&options.Parallelism, "parallelism", "", 1, "The number of previews to garbage collect in parallel")
+	cmd.Flags().DurationVarP(&options.RateLimitTimeout, "rate-limit-timeout", "", 10*time.Minute, "The maximum time to wait for the rate limit of a git server to reset")
+	cmd.Flags().IntVarP(&options.MaxFailures, "max-failures", "", 3, "The number of consecutive failures after which a preview is labelled with "+previews.LabelGCFailing)
+	options.Metrics.AddFlags(cmd)
 
 	return cmd, options
 }
 
 // Run implements this command
-func (o *Options) Run() error {
-	err := o.Validate()
+func (o *Options) Run() (err error) {
+	err = o.Validate()
 	if err != nil {
 		return fmt.Errorf("failed to validate options: %w", err)
 	}
+	defer o.EventRecorder.Flush()
+
+	phases := tracing.NewPhases(o.Tracer.Start("gc", attribute.Bool("jx.preview.gc.dry_run", o.DryRun)))
+	defer func() {
+		phases.End(err)
+		o.FlushTrace()
+	}()
+	o.startPhase(phases, "list")
+
+	var resources []v1alpha1.Preview
+	defer func() {
+		o.recordMetrics(resources)
+	}()
 
 	ns := o.Namespace
 	ctx := context.Background()
@@ -80,7 +153,7 @@ func (o *Options) Run() error {
 		}
 	}
 
-	resources := resourceList.Items
+	resources = resourceList.Items
 	previews.SortPreviews(resources)
 
 	if o.DryRun {
@@ -94,68 +167,288 @@ func (o *Options) Run() error {
 			}
 		}
 	}()
+
+	o.startPhase(phases, "previews")
+	o.pullRequests = newPullRequestCache(o)
+	results := o.gcPreviews(resources)
+	o.pullRequests.LogUsage()
+
+	var errs []error
 	for k := range resources {
-		preview := resources[k]
-		name := preview.Name
-		gitURL := preview.Spec.Source.CloneURL
-		if gitURL == "" {
-			log.Logger().Warnf("cannot GC preview %s as it has no spec.source.cloneURL", name)
+		preview := &resources[k]
+		result := results[k]
+		if result.err != nil {
+			o.Failures = append(o.Failures, Failure{Name: preview.Name, Error: result.err})
+			errs = append(errs, fmt.Errorf("preview %s: %w", preview.Name, result.err))
+			o.recordFailure(preview, result.err)
 			continue
 		}
-		prLink := preview.Spec.PullRequest.URL
-		owner := preview.Spec.PullRequest.Owner
-		if owner == "" {
-			log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.owner", name)
+		if result.deleted {
+			o.Deleted = append(o.Deleted, preview.Name)
 			continue
 		}
-		repository := preview.Spec.PullRequest.Repository
-		if repository == "" {
-			log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.repository", name)
-			continue
+		o.clearFailures(preview)
+	}
+
+	if !o.NoOrphans {
+		o.startPhase(phases, "orphans")
+		errs = append(errs, o.gcOrphans(resources)...)
+	}
+	o.startPhase(phases, "quotas")
+	errs = append(errs, o.enforceQuotas(resources)...)
+	if len(o.Failures) > 0 {
+		for _, f := range o.Failures {
+			log.Logger().Errorf("failed to garbage collect preview %s: %s", f.Name, f.Error.Error())
 		}
-		prNumber := preview.Spec.PullRequest.Number
-		if prNumber <= 0 {
-			log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.number", name)
-			continue
+		return fmt.Errorf("failed to garbage collect %d of %d previews: %w", len(o.Failures), len(resources), errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to garbage collect previews: %w", errors.Join(errs...))
+	}
+	if len(o.Deleted) == 0 && len(o.OrphanedNamespaces) == 0 && len(o.DanglingPreviews) == 0 && len(o.Evicted) == 0 {
+		log.Logger().Debug("no preview environments to garbage collect where found")
+		return nil
+	}
+	return nil
+}
+
+// enforceQuotas evicts the least recently updated previews which exceed the configured quotas
+func (o *Options) enforceQuotas(resources []v1alpha1.Preview) []error {
+	if o.Config == nil {
+		var err error
+		o.Config, err = previewconfig.LoadConfig(o.KubeClient, o.Namespace)
+		if err != nil {
+			return []error{fmt.Errorf("failed to load the preview configuration: %w", err)}
 		}
+	}
+	q := &o.Config.Quotas
+	if !q.Enabled() {
+		return nil
+	}
 
-		so := &scmhelpers.Options{
-			// lets avoid detecting the branch
-			Branch:    "master",
-			ScmClient: o.ScmClient,
-			SourceURL: gitURL,
-			Namespace: o.Namespace,
-			JXClient:  o.JXClient,
+	removed := map[string]bool{}
+	for _, name := range append(append([]string{}, o.Deleted...), o.DanglingPreviews...) {
+		removed[name] = true
+	}
+	var remaining []v1alpha1.Preview
+	for k := range resources {
+		if !removed[resources[k].Name] {
+			remaining = append(remaining, resources[k])
 		}
-		err = so.Validate()
+	}
+
+	evictions := quotas.Evictions(q, remaining, nil)
+	if len(evictions) == 0 {
+		return nil
+	}
+	if o.DryRun {
+		log.Logger().Info("These previews exceed the preview quotas and are selected for destruction:")
+	}
+	var errs []error
+	for _, preview := range evictions {
+		name := preview.Name
+		o.Evicted = append(o.Evicted, name)
+		if o.DryRun {
+			log.Logger().Info(name)
+			continue
+		}
+		log.Logger().Infof("evicting preview %s as it exceeds the preview quotas", info(name))
+		o.EventRecorder.Event(preview, corev1.EventTypeNormal, previews.ReasonEvicted, "evicted as it exceeds the preview quotas")
+		err := o.DestroyWithReason(name, "evicted as it exceeds the preview quotas")
 		if err != nil {
-			return fmt.Errorf("failed to validate preview %s with source URL %s: %w", name, preview.Spec.Source.URL, err)
+			errs = append(errs, fmt.Errorf("failed to evict preview %s: %w", name, err))
 		}
+	}
+	return errs
+}
+
+// gcPreviews garbage collects the previews using a pool of workers returning the result for each preview
+func (o *Options) gcPreviews(resources []v1alpha1.Preview) []gcResult {
+	results := make([]gcResult, len(resources))
+	parallelism := o.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := range indexes {
+				deleted, err := o.gcPreview(&resources[k])
+				results[k] = gcResult{deleted: deleted, err: err}
+			}
+		}()
+	}
+	for k := range resources {
+		indexes <- k
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// gcPreview garbage collects the given preview if its pull request is closed or its branch is removed, returning true if it was deleted
+func (o *Options) gcPreview(preview *v1alpha1.Preview) (bool, error) {
+	name := preview.Name
+	gitURL := preview.Spec.Source.CloneURL
+	if gitURL == "" {
+		log.Logger().Warnf("cannot GC preview %s as it has no spec.source.cloneURL", name)
+		return false, nil
+	}
+	prLink := preview.Spec.PullRequest.URL
+	owner := preview.Spec.PullRequest.Owner
+	if owner == "" {
+		log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.owner", name)
+		return false, nil
+	}
+	repository := preview.Spec.PullRequest.Repository
+	if repository == "" {
+		log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.repository", name)
+		return false, nil
+	}
+	if preview.Spec.Branch != nil {
+		return o.gcBranchPreview(preview, gitURL, owner, repository)
+	}
+	prNumber := preview.Spec.PullRequest.Number
+	if prNumber <= 0 {
+		log.Logger().Warnf("cannot GC preview %s as it has no spec.pullRequest.number", name)
+		return false, nil
+	}
 
-		scmClient := so.ScmClient
-		fullName := scm.Join(owner, repository)
+	ctx := context.Background()
+	pullRequest, err := o.pullRequests.Find(ctx, gitURL, owner, repository, prNumber)
+	if err != nil {
+		return false, fmt.Errorf("failed to query PullRequest %s: %w", prLink, err)
+	}
+
+	if !o.isFinished(pullRequest) {
+		return false, nil
+	}
 
-		ctx := context.Background()
-		pullRequest, _, err := scmClient.PullRequests.Find(ctx, fullName, prNumber)
+	// linked pull requests are assumed to be on the same git server
+	for i := range preview.Spec.LinkedPullRequests {
+		link := &preview.Spec.LinkedPullRequests[i]
+		if link.Number <= 0 || link.Owner == "" || link.Repository == "" {
+			continue
+		}
+		linked, err := o.pullRequests.Find(ctx, gitURL, link.Owner, link.Repository, link.Number)
 		if err != nil {
-			return fmt.Errorf("failed to query PullRequest %s: %w", prLink, err)
+			return false, fmt.Errorf("failed to query linked PullRequest %s/%s#%d: %w", link.Owner, link.Repository, link.Number, err)
 		}
+		if !o.isFinished(linked) {
+			log.Logger().Debugf("keeping preview %s as linked pull request %s/%s#%d is still open", name, link.Owner, link.Repository, link.Number)
+			return false, nil
+		}
+	}
+	return o.destroyPreview(preview, fmt.Sprintf("pull request %s is %s", prLink, pullRequestState(pullRequest)))
+}
 
-		if pullRequest.Closed || pullRequest.Merged || (o.DestroyDrafts && pullRequest.Draft && !scmhelpers.ContainsLabel(pullRequest.Labels, "ok-to-test")) {
-			if !o.DryRun {
-				err = o.Destroy(name)
-				if err != nil {
-					return fmt.Errorf("failed to destroy preview environment %s: %v", name, err)
-				}
-			} else {
-				log.Logger().Info(name)
-			}
-			o.Deleted = append(o.Deleted, name)
+// pullRequestState returns why the pull request no longer needs a preview
+func pullRequestState(pr *scm.PullRequest) string {
+	switch {
+	case pr.Merged:
+		return "merged"
+	case pr.Closed:
+		return "closed"
+	default:
+		return "a draft"
+	}
+}
+
+// isFinished returns true if the pull request no longer needs a preview
+func (o *Options) isFinished(pr *scm.PullRequest) bool {
+	return pr.Closed || pr.Merged || (o.DestroyDrafts && pr.Draft && !scmhelpers.ContainsLabel(pr.Labels, "ok-to-test"))
+}
+
+// gcBranchPreview garbage collects a branch preview if its TTL has expired or its branch or tag has been removed
+func (o *Options) gcBranchPreview(preview *v1alpha1.Preview, gitURL, owner, repository string) (bool, error) {
+	name := preview.Name
+	branch := preview.Spec.Branch
+	ttl := o.BranchTTL
+	if branch.TTL != nil {
+		ttl = branch.TTL.Duration
+	}
+	if ttl > 0 && time.Since(quotas.LastUpdated(preview)) > ttl {
+		log.Logger().Infof("preview %s of branch %s has expired", info(name), info(branch.Name))
+		return o.destroyPreview(preview, fmt.Sprintf("the preview of branch %s has expired", branch.Name))
+	}
+
+	exists, err := o.pullRequests.RefExists(context.Background(), gitURL, owner, repository, branch.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to check if branch %s exists: %w", branch.Name, err)
+	}
+	if exists {
+		return false, nil
+	}
+	log.Logger().Infof("branch %s of preview %s has been removed", info(branch.Name), info(name))
+	return o.destroyPreview(preview, fmt.Sprintf("branch %s has been removed", branch.Name))
+}
+
+// destroyPreview destroys the preview unless this is a dry run
+func (o *Options) destroyPreview(preview *v1alpha1.Preview, reason string) (bool, error) {
+	name := preview.Name
+	if o.DryRun {
+		log.Logger().Info(name)
+		return true, nil
+	}
+	o.EventRecorder.Event(preview, corev1.EventTypeNormal, previews.ReasonGarbageCollecting, reason)
+	err := o.DestroyWithReason(name, reason)
+	if err != nil {
+		return false, fmt.Errorf("failed to destroy preview environment %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// recordFailure increments the failure count on the preview and flags it once it has failed too many times
+func (o *Options) recordFailure(preview *v1alpha1.Preview, gcErr error) {
+	failures := 1
+	count, err := strconv.Atoi(preview.Annotations[previews.AnnotationGCFailures])
+	if err == nil {
+		failures = count + 1
+	}
+	annotations := map[string]string{
+		previews.AnnotationGCFailures:  strconv.Itoa(failures),
+		previews.AnnotationGCLastError: gcErr.Error(),
+	}
+	var labels map[string]string
+	if !o.DryRun {
+		o.EventRecorder.Eventf(preview, corev1.EventTypeWarning, previews.ReasonGarbageCollectionFailed, "failed to garbage collect the preview: %s", gcErr.Error())
+	}
+	if o.MaxFailures > 0 && failures >= o.MaxFailures {
+		labels = map[string]string{
+			previews.LabelGCFailing: "true",
 		}
+		log.Logger().Warnf("preview %s has failed to be garbage collected %d times", preview.Name, failures)
 	}
-	if len(o.Deleted) == 0 {
-		log.Logger().Debug("no preview environments to garbage collect where found")
-		return nil
+	o.patchPreview(preview, annotations, labels)
+}
+
+// clearFailures removes any failure flags from a preview which was garbage collected successfully
+func (o *Options) clearFailures(preview *v1alpha1.Preview) {
+	if preview.Annotations[previews.AnnotationGCFailures] == "" && preview.Labels[previews.LabelGCFailing] == "" {
+		return
+	}
+	annotations := map[string]string{
+		previews.AnnotationGCFailures:  "",
+		previews.AnnotationGCLastError: "",
+	}
+	labels := map[string]string{
+		previews.LabelGCFailing: "",
+	}
+	o.patchPreview(preview, annotations, labels)
+}
+
+// patchPreview patches the garbage collection annotations and labels of the preview so that changes made to
+// the preview by other runs since it was listed are not overwritten
+func (o *Options) patchPreview(preview *v1alpha1.Preview, annotations, labels map[string]string) {
+	if o.DryRun {
+		return
+	}
+	_, err := previews.PatchMetadata(o.PreviewClient, o.Namespace, preview.Name, previews.GCFieldManager, annotations, labels)
+	if err != nil {
+		log.Logger().Warnf("failed to update preview %s: %s", preview.Name, err.Error())
 	}
-	return nil
 }
@@ -4,12 +4,18 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/fake"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/cmd/gc"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/previews/fakepreviews"
 	"github.com/jenkins-x/go-scm/scm"
 	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
@@ -18,7 +24,9 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	fakekube "k8s.io/client-go/kubernetes/fake"
 )
 
@@ -152,3 +160,277 @@ func TestPreviewGC(t *testing.T) {
 		t.Logf("fake comamnds: %s\n", c.CLI())
 	}
 }
+
+func TestPreviewGCContinuesAfterFailure(t *testing.T) {
+	ns := "jx"
+
+	scmClient, fakeScmData := fakescm.NewDefault()
+
+	preview1, pr1 := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 2)
+	preview2, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "another", 3)
+	preview3, pr3 := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "athird", 4)
+
+	// lets make querying the pull request of the second preview fail
+	delete(fakeScmData.PullRequests, 3)
+	pr1.Closed = true
+	pr3.Merged = true
+
+	previewClient := fake.NewSimpleClientset(preview1, preview2, preview3)
+
+	devEnv := jxenv.CreateDefaultDevEnvironment(ns)
+	devEnv.Namespace = ns
+	devEnv.Spec.Source.URL = "https://github.com/myorg/my-gitops-repo.git"
+
+	runner := &fakerunner.FakeRunner{}
+	for i := 1; i <= 2; i++ {
+		_, o := gc.NewCmdGCPreviews()
+		o.GitUser = "fakeuser"
+		o.GitToken = "faketoken"
+		o.PreviewClient = previewClient
+		o.KubeClient = fakekube.NewSimpleClientset()
+		o.JXClient = jxfake.NewSimpleClientset(devEnv)
+		o.Namespace = ns
+		o.ScmClient = scmClient
+		o.CommandRunner = runner.Run
+		o.Parallelism = 2
+		o.MaxFailures = 2
+
+		err := o.Run()
+		require.Error(t, err, "should have failed the GC for run %d", i)
+		require.Len(t, o.Failures, 1, "failures for run %d", i)
+		assert.Equal(t, preview2.Name, o.Failures[0].Name, "failed preview for run %d", i)
+
+		if i == 1 {
+			assert.ElementsMatch(t, []string{preview1.Name, preview3.Name}, o.Deleted, "deleted previews")
+		} else {
+			assert.Empty(t, o.Deleted, "deleted previews")
+		}
+
+		failed, err := previewClient.PreviewV1alpha1().Previews(ns).Get(context.Background(), preview2.Name, metav1.GetOptions{})
+		require.NoError(t, err, "failed to get preview %s", preview2.Name)
+		assert.Equal(t, strconv.Itoa(i), failed.Annotations[previews.AnnotationGCFailures], "failure count for run %d", i)
+		if i < o.MaxFailures {
+			assert.Empty(t, failed.Labels[previews.LabelGCFailing], "failing label for run %d", i)
+		} else {
+			assert.Equal(t, "true", failed.Labels[previews.LabelGCFailing], "failing label for run %d", i)
+		}
+	}
+}
+
+func TestPreviewGCParallel(t *testing.T) {
+	ns := "jx"
+	scmClient, fakeScmData := fakescm.NewDefault()
+
+	var resources []runtime.Object
+	var names []string
+	for i := 1; i <= 6; i++ {
+		preview, pr := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo"+strconv.Itoa(i), i)
+		preview.Spec.DestroyCommand = v1alpha1.Command{Command: "helmfile", Args: []string{"destroy"}, Path: "preview"}
+		pr.Closed = true
+		resources = append(resources, preview)
+		names = append(names, preview.Name)
+	}
+
+	devEnv := jxenv.CreateDefaultDevEnvironment(ns)
+	devEnv.Namespace = ns
+	devEnv.Spec.Source.URL = "https://github.com/myorg/my-gitops-repo.git"
+
+	var lock sync.Mutex
+	devClones := 0
+	var destroyed []string
+	runner := func(c *cmdrunner.Command) (string, error) {
+		switch {
+		case c.Name == "git" && c.Args[0] == "clone":
+			dir := c.Args[len(c.Args)-1]
+			if strings.Contains(c.Args[len(c.Args)-2], "my-gitops-repo") {
+				lock.Lock()
+				devClones++
+				lock.Unlock()
+				// lets give the other workers time to use the clone while it is being created
+				time.Sleep(100 * time.Millisecond)
+				err := os.MkdirAll(filepath.Join(dir, "helmfiles", "jx"), 0755)
+				if err != nil {
+					return "", err
+				}
+				return "", os.WriteFile(filepath.Join(dir, "helmfiles", "jx", "jx-values.yaml"), []byte("jxRequirements: {}\n"), 0600)
+			}
+			return "", os.MkdirAll(filepath.Join(dir, "preview"), 0755)
+		case c.Name == "helmfile":
+			// each preview should be destroyed with its own jx-values.yaml file
+			_, err := os.Stat(filepath.Join(c.Dir, "jx-values.yaml"))
+			if err != nil {
+				return "", err
+			}
+			lock.Lock()
+			destroyed = append(destroyed, c.Dir)
+			lock.Unlock()
+		}
+		return "", nil
+	}
+
+	_, o := gc.NewCmdGCPreviews()
+	o.GitUser = "fakeuser"
+	o.GitToken = "faketoken"
+	o.PreviewClient = fake.NewSimpleClientset(resources...)
+	o.KubeClient = fakekube.NewSimpleClientset()
+	o.JXClient = jxfake.NewSimpleClientset(devEnv)
+	o.Namespace = ns
+	o.ScmClient = scmClient
+	o.CommandRunner = runner
+	o.Parallelism = 4
+	o.FailOnHelmError = true
+
+	err := o.Run()
+	require.NoError(t, err, "should not have failed the GC")
+	assert.ElementsMatch(t, names, o.Deleted, "deleted previews")
+	assert.Len(t, destroyed, len(names), "destroyed previews")
+	assert.Equal(t, 1, devClones, "the dev environment should be cloned once")
+}
+
+func TestPreviewGCOrphans(t *testing.T) {
+	ns := "jx"
+
+	scmClient, fakeScmData := fakescm.NewDefault()
+
+	created := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+
+	preview1, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 1)
+	preview2, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 2)
+	preview2.CreationTimestamp = created
+
+	newPreview, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 3)
+	newPreview.CreationTimestamp = metav1.Now()
+
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Labels:            labels,
+				CreationTimestamp: created,
+			},
+		}
+	}
+	kubeClient := fakekube.NewSimpleClientset(
+		namespace(ns, nil),
+		namespace("jx-staging", nil),
+		namespace(preview1.Spec.Resources.Namespace, nil),
+		namespace("jx-myower-removed-pr-7", nil),
+		namespace("labelled-preview", map[string]string{
+			previews.LabelPreviewName:      "removed-preview",
+			previews.LabelPreviewNamespace: ns,
+		}),
+		namespace("other-preview", map[string]string{
+			previews.LabelPreviewName:      "removed-preview",
+			previews.LabelPreviewNamespace: "another-ns",
+		}),
+	)
+
+	previewClient := fake.NewSimpleClientset(preview1, preview2, newPreview)
+
+	for _, dryRun := range []bool{true, false} {
+		_, o := gc.NewCmdGCPreviews()
+		o.PreviewClient = previewClient
+		o.KubeClient = kubeClient
+		o.JXClient = jxfake.NewSimpleClientset()
+		o.Namespace = ns
+		o.ScmClient = scmClient
+		o.CommandRunner = (&fakerunner.FakeRunner{}).Run
+		o.DryRun = dryRun
+
+		err := o.Run()
+		require.NoError(t, err, "should not have failed the GC with dry run %v", dryRun)
+
+		assert.Empty(t, o.Deleted, "deleted previews with dry run %v", dryRun)
+		assert.ElementsMatch(t, []string{"jx-myower-removed-pr-7", "labelled-preview"}, o.OrphanedNamespaces, "orphaned namespaces with dry run %v", dryRun)
+		assert.Equal(t, []string{preview2.Name}, o.DanglingPreviews, "dangling previews with dry run %v", dryRun)
+	}
+
+	ctx := context.Background()
+	namespaceList, err := kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	require.NoError(t, err, "failed to list namespaces")
+	var namespaces []string
+	for k := range namespaceList.Items {
+		namespaces = append(namespaces, namespaceList.Items[k].Name)
+	}
+	assert.ElementsMatch(t, []string{ns, "jx-staging", preview1.Spec.Resources.Namespace, "other-preview"}, namespaces, "remaining namespaces")
+
+	previewList, err := previewClient.PreviewV1alpha1().Previews(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err, "failed to list the remaining previews in ns %s", ns)
+	var names []string
+	for k := range previewList.Items {
+		names = append(names, previewList.Items[k].Name)
+	}
+	assert.ElementsMatch(t, []string{preview1.Name, newPreview.Name}, names, "remaining previews")
+}
+
+func TestPreviewGCBranchTTL(t *testing.T) {
+	ns := "jx"
+
+	scmClient, fakeScmData := fakescm.NewDefault()
+
+	expired, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 1)
+	expired.Name = "myower-myrepo-release-1"
+	expired.Spec.PullRequest.Number = 0
+	expired.Spec.Branch = &v1alpha1.PreviewBranch{
+		Name: "release-1",
+		TTL:  &metav1.Duration{Duration: time.Hour},
+	}
+	expired.Annotations = map[string]string{
+		previews.AnnotationLastUpdated: time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	preview, _ := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "myrepo", 2)
+
+	_, o := gc.NewCmdGCPreviews()
+	o.PreviewClient = fake.NewSimpleClientset(expired, preview)
+	o.KubeClient = fakekube.NewSimpleClientset()
+	o.JXClient = jxfake.NewSimpleClientset()
+	o.Namespace = ns
+	o.ScmClient = scmClient
+	o.CommandRunner = (&fakerunner.FakeRunner{}).Run
+	o.DryRun = true
+	o.NoOrphans = true
+
+	err := o.Run()
+	require.NoError(t, err, "should not have failed the GC")
+	assert.Equal(t, []string{expired.Name}, o.Deleted, "expired branch previews should be deleted")
+}
+
+func TestPreviewGCLinkedPullRequests(t *testing.T) {
+	ns := "jx"
+
+	scmClient, fakeScmData := fakescm.NewDefault()
+
+	preview, pr := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "frontend", 1)
+	_, linkedPR := fakepreviews.CreateTestPreviewAndPullRequest(fakeScmData, ns, "myower", "backend", 2)
+	preview.Spec.LinkedPullRequests = []v1alpha1.PullRequest{
+		{
+			Owner:      "myower",
+			Repository: "backend",
+			Number:     2,
+		},
+	}
+	pr.Merged = true
+
+	previewClient := fake.NewSimpleClientset(preview)
+	for _, linkedMerged := range []bool{false, true} {
+		linkedPR.Merged = linkedMerged
+
+		_, o := gc.NewCmdGCPreviews()
+		o.PreviewClient = previewClient
+		o.KubeClient = fakekube.NewSimpleClientset()
+		o.JXClient = jxfake.NewSimpleClientset()
+		o.Namespace = ns
+		o.ScmClient = scmClient
+		o.CommandRunner = (&fakerunner.FakeRunner{}).Run
+		o.DryRun = true
+		o.NoOrphans = true
+
+		err := o.Run()
+		require.NoError(t, err, "should not have failed the GC")
+		if linkedMerged {
+			assert.Equal(t, []string{preview.Name}, o.Deleted, "preview should be deleted once all linked pull requests are merged")
+		} else {
+			assert.Empty(t, o.Deleted, "preview should be kept while a linked pull request is open")
+		}
+	}
+}
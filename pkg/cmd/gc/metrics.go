@@ -0,0 +1,39 @@
+package gc
+
+import (
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+)
+
+// recordMetrics records the actions taken and the previews of each repository which remain then exports the metrics
+func (o *Options) recordMetrics(resources []v1alpha1.Preview) {
+	if o.DryRun {
+		return
+	}
+	metrics.GCActions.WithLabelValues("deleted").Add(float64(len(o.Deleted)))
+	metrics.GCActions.WithLabelValues("evicted").Add(float64(len(o.Evicted)))
+	metrics.GCActions.WithLabelValues("orphaned_namespace").Add(float64(len(o.OrphanedNamespaces)))
+	metrics.GCActions.WithLabelValues("dangling_preview").Add(float64(len(o.DanglingPreviews)))
+	metrics.GCActions.WithLabelValues("failed").Add(float64(len(o.Failures)))
+
+	removed := map[string]bool{}
+	for _, names := range [][]string{o.Deleted, o.Evicted, o.DanglingPreviews} {
+		for _, name := range names {
+			removed[name] = true
+		}
+	}
+	counts := map[[2]string]int{}
+	for k := range resources {
+		preview := &resources[k]
+		if removed[preview.Name] {
+			continue
+		}
+		counts[[2]string{preview.Spec.PullRequest.Owner, preview.Spec.PullRequest.Repository}]++
+	}
+	metrics.Previews.Reset()
+	for key, count := range counts {
+		metrics.Previews.WithLabelValues(key[0], key[1]).Set(float64(count))
+	}
+
+	o.ExportMetrics("gc")
+}
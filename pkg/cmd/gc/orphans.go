@@ -0,0 +1,112 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// gcOrphans removes preview namespaces which no longer have a Preview and Previews whose namespace no longer exists
+func (o *Options) gcOrphans(resources []v1alpha1.Preview) []error {
+	ctx := context.Background()
+	namespaceList, err := o.KubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return []error{fmt.Errorf("failed to list namespaces: %w", err)}
+	}
+
+	deleted := map[string]bool{}
+	for _, name := range o.Deleted {
+		deleted[name] = true
+	}
+
+	// lets include previews we just garbage collected so a dry run does not also report their namespaces
+	previewNamespaces := map[string]bool{}
+	previewNames := map[string]bool{}
+	for k := range resources {
+		preview := &resources[k]
+		previewNames[preview.Name] = true
+		if preview.Spec.Resources.Namespace != "" {
+			previewNamespaces[preview.Spec.Resources.Namespace] = true
+		}
+	}
+
+	namespaces := map[string]bool{}
+	for k := range namespaceList.Items {
+		namespace := &namespaceList.Items[k]
+		namespaces[namespace.Name] = true
+
+		if !previews.IsPreviewNamespace(namespace, o.Namespace) || previewNamespaces[namespace.Name] {
+			continue
+		}
+		previewName := namespace.Labels[previews.LabelPreviewName]
+		if previewName != "" && previewNames[previewName] {
+			continue
+		}
+		if namespace.Status.Phase == corev1.NamespaceTerminating || !o.olderThanGracePeriod(namespace.CreationTimestamp) {
+			continue
+		}
+		o.OrphanedNamespaces = append(o.OrphanedNamespaces, namespace.Name)
+	}
+
+	for k := range resources {
+		preview := &resources[k]
+		previewNamespace := preview.Spec.Resources.Namespace
+		if deleted[preview.Name] || previewNamespace == "" || namespaces[previewNamespace] || !o.olderThanGracePeriod(preview.CreationTimestamp) {
+			continue
+		}
+		o.DanglingPreviews = append(o.DanglingPreviews, preview.Name)
+	}
+
+	if o.DryRun {
+		if len(o.OrphanedNamespaces) > 0 {
+			log.Logger().Info("These preview namespaces have no Preview and are selected for destruction:")
+			for _, name := range o.OrphanedNamespaces {
+				log.Logger().Info(name)
+			}
+		}
+		if len(o.DanglingPreviews) > 0 {
+			log.Logger().Info("These previews have no preview namespace and are selected for destruction:")
+			for _, name := range o.DanglingPreviews {
+				log.Logger().Info(name)
+			}
+		}
+		return nil
+	}
+
+	var errs []error
+	for _, name := range o.OrphanedNamespaces {
+		err = o.KubeClient.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete orphaned preview namespace %s: %w", name, err))
+			continue
+		}
+		log.Logger().Infof("deleted orphaned preview namespace %s", info(name))
+	}
+	for _, name := range o.DanglingPreviews {
+		err = o.PreviewClient.PreviewV1alpha1().Previews(o.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("failed to delete preview %s without a preview namespace: %w", name, err))
+			continue
+		}
+		log.Logger().Infof("deleted preview %s as its preview namespace no longer exists", info(name))
+		for k := range resources {
+			if resources[k].Name == name {
+				o.NotifyDestroyed(&resources[k], "its preview namespace no longer exists")
+			}
+		}
+	}
+	return errs
+}
+
+// olderThanGracePeriod returns true if the resource was created long enough ago that a preview being
+// created concurrently should have created both the Preview and its namespace
+func (o *Options) olderThanGracePeriod(created metav1.Time) bool {
+	return !created.IsZero() && time.Since(created.Time) > o.OrphanGracePeriod
+}
@@ -0,0 +1,287 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/giturl"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/scmhelpers"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"k8s.io/utils/clock"
+)
+
+// pullRequestPageSize the number of pull requests to query in each page
+const pullRequestPageSize = 100
+
+// pullRequestCache caches the open pull requests for each repository so that we only query
+// each repository once and reuses a single scm client for each git server
+type pullRequestCache struct {
+	options          *Options
+	lock             sync.Mutex
+	servers          map[string]*gitServer
+	repositories     map[string]*repositoryPullRequests
+	rateLimitTimeout time.Duration
+	clock            clock.Clock
+}
+
+// gitServer the scm client for a git server along with the API budget we have used
+type gitServer struct {
+	url       string
+	client    *scm.Client
+	clock     clock.Clock
+	lock      sync.Mutex
+	calls     int
+	firstRate *scm.Rate
+	lastRate  scm.Rate
+}
+
+// repositoryPullRequests the open pull requests of a repository
+type repositoryPullRequests struct {
+	once         sync.Once
+	pullRequests map[int]*scm.PullRequest
+	err          error
+}
+
+func newPullRequestCache(o *Options) *pullRequestCache {
+	return &pullRequestCache{
+		options:          o,
+		servers:          map[string]*gitServer{},
+		repositories:     map[string]*repositoryPullRequests{},
+		rateLimitTimeout: o.RateLimitTimeout,
+		clock:            clock.RealClock{},
+	}
+}
+
+// Find finds the pull request for the given repository, using the cached list of open pull requests
+// and only querying pull requests individually if they are no longer open
+func (c *pullRequestCache) Find(ctx context.Context, gitURL, owner, repository string, number int) (*scm.PullRequest, error) {
+	server, err := c.gitServer(gitURL)
+	if err != nil {
+		return nil, err
+	}
+	fullName := scm.Join(owner, repository)
+	repo := c.repository(server.url + "/" + fullName)
+	repo.once.Do(func() {
+		repo.pullRequests, repo.err = server.listOpenPullRequests(ctx, fullName, c.rateLimitTimeout)
+	})
+	if repo.err != nil {
+		return nil, repo.err
+	}
+	pr := repo.pullRequests[number]
+	if pr != nil {
+		return pr, nil
+	}
+
+	// the pull request is no longer open so lets check its current state
+	return server.findPullRequest(ctx, fullName, number, c.rateLimitTimeout)
+}
+
+// RefExists returns true if the branch or tag still exists in the repository
+func (c *pullRequestCache) RefExists(ctx context.Context, gitURL, owner, repository, name string) (bool, error) {
+	server, err := c.gitServer(gitURL)
+	if err != nil {
+		return false, err
+	}
+	fullName := scm.Join(owner, repository)
+	finders := []func(context.Context, string, string) (*scm.Reference, *scm.Response, error){
+		server.client.Git.FindBranch,
+		server.client.Git.FindTag,
+	}
+	for _, find := range finders {
+		var res *scm.Response
+		err = server.call(c.rateLimitTimeout, func() (*scm.Response, error) {
+			var err error
+			_, res, err = find(ctx, fullName, name)
+			return res, err
+		})
+		if err == nil {
+			return true, nil
+		}
+		if !scm.IsScmNotFound(err) && (res == nil || res.Status != http.StatusNotFound) {
+			return false, fmt.Errorf("failed to query ref %s of repository %s: %w", name, fullName, err)
+		}
+	}
+	return false, nil
+}
+
+// LogUsage logs the API budget used on each git server
+func (c *pullRequestCache) LogUsage() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, server := range c.servers {
+		server.lock.Lock()
+		if server.firstRate == nil {
+			log.Logger().Infof("made %d API calls to git server %s", server.calls, info(server.url))
+		} else {
+			rate := server.lastRate
+			used := server.firstRate.Remaining - rate.Remaining
+			log.Logger().Infof("made %d API calls to git server %s using %d of the rate limit with %d of %d remaining until %s",
+				server.calls, info(server.url), used, rate.Remaining, rate.Limit, time.Unix(rate.Reset, 0).Format(time.RFC3339))
+		}
+		server.lock.Unlock()
+	}
+}
+
+func (c *pullRequestCache) gitServer(gitURL string) (*gitServer, error) {
+	gitInfo, err := giturl.ParseGitURL(gitURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse git URL %s: %w", gitURL, err)
+	}
+	serverURL := gitInfo.HostURL()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	server := c.servers[serverURL]
+	if server != nil {
+		return server, nil
+	}
+	o := c.options
+	so := &scmhelpers.Options{
+		// lets avoid detecting the branch
+		Branch:    "master",
+		ScmClient: o.ScmClient,
+		SourceURL: gitURL,
+		Namespace: o.Namespace,
+		JXClient:  o.JXClient,
+	}
+	err = so.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scm client for git server %s: %w", serverURL, err)
+	}
+	server = &gitServer{
+		url:    serverURL,
+		client: so.ScmClient,
+		clock:  c.clock,
+	}
+	c.servers[serverURL] = server
+	return server, nil
+}
+
+func (c *pullRequestCache) repository(key string) *repositoryPullRequests {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	repo := c.repositories[key]
+	if repo == nil {
+		repo = &repositoryPullRequests{}
+		c.repositories[key] = repo
+	}
+	return repo
+}
+
+func (s *gitServer) listOpenPullRequests(ctx context.Context, fullName string, timeout time.Duration) (map[int]*scm.PullRequest, error) {
+	answer := map[int]*scm.PullRequest{}
+	opts := &scm.PullRequestListOptions{
+		Page: 1,
+		Size: pullRequestPageSize,
+		Open: true,
+	}
+	for {
+		var prs []*scm.PullRequest
+		err := s.call(timeout, func() (*scm.Response, error) {
+			var res *scm.Response
+			var err error
+			prs, res, err = s.client.PullRequests.List(ctx, fullName, opts)
+			return res, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list open pull requests of repository %s: %w", fullName, err)
+		}
+		for _, pr := range prs {
+			answer[pr.Number] = pr
+		}
+		if len(prs) < opts.Size {
+			break
+		}
+		opts.Page++
+	}
+	log.Logger().Debugf("found %d open pull requests in repository %s", len(answer), fullName)
+	return answer, nil
+}
+
+func (s *gitServer) findPullRequest(ctx context.Context, fullName string, number int, timeout time.Duration) (*scm.PullRequest, error) {
+	var pr *scm.PullRequest
+	err := s.call(timeout, func() (*scm.Response, error) {
+		var res *scm.Response
+		var err error
+		pr, res, err = s.client.PullRequests.Find(ctx, fullName, number)
+		return res, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pull request %s#%d: %w", fullName, number, err)
+	}
+	return pr, nil
+}
+
+// call invokes the API call retrying with a backoff if we hit the rate limit of the git server.
+// The backoff waits using the clock of the git server so that tests do not have to sleep
+func (s *gitServer) call(timeout time.Duration, fn func() (*scm.Response, error)) error {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = timeout
+	bo.Clock = s.clock
+	bo.Reset()
+
+	for {
+		s.waitForRateLimit(bo.MaxElapsedTime)
+		res, err := fn()
+		s.recordCall(res)
+		if err == nil || !isRateLimited(res) {
+			return err
+		}
+		next := bo.NextBackOff()
+		if next == backoff.Stop {
+			return err
+		}
+		log.Logger().Warnf("hit the rate limit of git server %s so backing off for %s: %s", s.url, next.String(), err.Error())
+		s.clock.Sleep(next)
+	}
+}
+
+func (s *gitServer) recordCall(res *scm.Response) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.calls++
+	if res == nil || res.Rate.Limit <= 0 {
+		return
+	}
+	if s.firstRate == nil {
+		rate := res.Rate
+		s.firstRate = &rate
+	}
+	s.lastRate = res.Rate
+}
+
+// waitForRateLimit waits until the rate limit resets if we have used up the API budget
+func (s *gitServer) waitForRateLimit(maxWait time.Duration) {
+	s.lock.Lock()
+	rate := s.lastRate
+	s.lock.Unlock()
+
+	if rate.Limit <= 0 || rate.Remaining > 0 || rate.Reset <= 0 {
+		return
+	}
+	wait := time.Unix(rate.Reset, 0).Sub(s.clock.Now())
+	if wait <= 0 {
+		return
+	}
+	if wait > maxWait {
+		wait = maxWait
+	}
+	log.Logger().Warnf("used up the rate limit of git server %s so waiting %s for it to reset", s.url, wait.String())
+	s.clock.Sleep(wait)
+}
+
+func isRateLimited(res *scm.Response) bool {
+	if res == nil {
+		return false
+	}
+	return res.Status == http.StatusTooManyRequests || (res.Status == http.StatusForbidden && res.Rate.Limit > 0 && res.Rate.Remaining == 0)
+}
@@ -0,0 +1,274 @@
+package gc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/fakescms"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+// fakePullRequests records the calls to the fake driver returning the queued responses as errors first
+type fakePullRequests struct {
+	scm.PullRequestService
+	lists     map[string]int
+	finds     []int
+	responses []*scm.Response
+}
+
+func (s *fakePullRequests) List(ctx context.Context, fullName string, opts *scm.PullRequestListOptions) ([]*scm.PullRequest, *scm.Response, error) {
+	s.lists[fullName]++
+	if len(s.responses) > 0 {
+		res := s.responses[0]
+		s.responses = s.responses[1:]
+		if res.Status != http.StatusOK {
+			return nil, res, errors.New(http.StatusText(res.Status))
+		}
+		prs, _, err := s.PullRequestService.List(ctx, fullName, opts)
+		return prs, res, err
+	}
+	return s.PullRequestService.List(ctx, fullName, opts)
+}
+
+func (s *fakePullRequests) Find(ctx context.Context, fullName string, number int) (*scm.PullRequest, *scm.Response, error) {
+	s.finds = append(s.finds, number)
+	return s.PullRequestService.Find(ctx, fullName, number)
+}
+
+// fakeRefs implements the branch and tag lookups which are not supported by the fake driver
+type fakeRefs struct {
+	scm.GitService
+	branches map[string]bool
+	tags     map[string]bool
+	err      error
+	calls    []string
+}
+
+func (s *fakeRefs) FindBranch(_ context.Context, _, name string) (*scm.Reference, *scm.Response, error) {
+	s.calls = append(s.calls, "branch:"+name)
+	if s.err != nil {
+		return nil, &scm.Response{Status: http.StatusInternalServerError}, s.err
+	}
+	return s.find(s.branches, name)
+}
+
+func (s *fakeRefs) FindTag(_ context.Context, _, name string) (*scm.Reference, *scm.Response, error) {
+	s.calls = append(s.calls, "tag:"+name)
+	return s.find(s.tags, name)
+}
+
+func (s *fakeRefs) find(refs map[string]bool, name string) (*scm.Reference, *scm.Response, error) {
+	if !refs[name] {
+		return nil, &scm.Response{Status: http.StatusNotFound}, scm.ErrNotFound
+	}
+	return &scm.Reference{Name: name}, &scm.Response{Status: http.StatusOK}, nil
+}
+
+func newTestPullRequestCache(t *testing.T) (*pullRequestCache, *fakescm.Data, *fakePullRequests, *clocktesting.FakeClock) {
+	ns := "jx"
+	scmClient, fakeData := fakescm.NewDefault()
+	pullRequests := &fakePullRequests{PullRequestService: scmClient.PullRequests, lists: map[string]int{}}
+	scmClient.PullRequests = pullRequests
+
+	devEnv := jxenv.CreateDefaultDevEnvironment(ns)
+	devEnv.Namespace = ns
+	devEnv.Spec.Source.URL = "https://fake.com/myorg/my-gitops-repo.git"
+
+	o := &Options{RateLimitTimeout: time.Minute}
+	o.Namespace = ns
+	o.ScmClient = scmClient
+	o.JXClient = jxfake.NewSimpleClientset(devEnv)
+
+	c := newPullRequestCache(o)
+	fakeClock := clocktesting.NewFakeClock(time.Unix(1700000000, 0))
+	c.clock = fakeClock
+	_, err := c.gitServer("https://fake.com/myowner/myrepo.git")
+	require.NoError(t, err, "failed to create the git server")
+	return c, fakeData, pullRequests, fakeClock
+}
+
+func TestPullRequestCacheListsEachRepositoryOnce(t *testing.T) {
+	ctx := context.Background()
+	c, fakeData, pullRequests, _ := newTestPullRequestCache(t)
+	fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 1)
+	fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 2)
+	fakescms.CreatePullRequest(fakeData, "myowner", "another", 3)
+
+	for _, number := range []int{1, 2, 1} {
+		pr, err := c.Find(ctx, "https://fake.com/myowner/myrepo.git", "myowner", "myrepo", number)
+		require.NoError(t, err, "failed to find pull request %d", number)
+		assert.Equal(t, number, pr.Number, "pull request number")
+	}
+	pr, err := c.Find(ctx, "https://fake.com/myowner/another.git", "myowner", "another", 3)
+	require.NoError(t, err, "failed to find pull request 3")
+	assert.Equal(t, 3, pr.Number, "pull request number")
+
+	assert.Equal(t, map[string]int{"myowner/myrepo": 1, "myowner/another": 1}, pullRequests.lists, "each repository should be listed once")
+	assert.Empty(t, pullRequests.finds, "open pull requests should not be queried individually")
+}
+
+func TestPullRequestCacheFindsClosedPullRequests(t *testing.T) {
+	ctx := context.Background()
+	c, fakeData, pullRequests, _ := newTestPullRequestCache(t)
+	fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 1)
+	fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 2).Closed = true
+
+	pr, err := c.Find(ctx, "https://fake.com/myowner/myrepo.git", "myowner", "myrepo", 2)
+	require.NoError(t, err, "failed to find closed pull request")
+	assert.True(t, pr.Closed, "pull request should be closed")
+	assert.Equal(t, []int{2}, pullRequests.finds, "closed pull requests should be queried individually")
+	assert.Equal(t, 1, pullRequests.lists["myowner/myrepo"], "list calls")
+}
+
+func TestPullRequestCacheBacksOffWhenRateLimited(t *testing.T) {
+	testCases := []struct {
+		name      string
+		response  *scm.Response
+		retried   bool
+		expectErr bool
+	}{
+		{
+			name:     "too-many-requests",
+			response: &scm.Response{Status: http.StatusTooManyRequests},
+			retried:  true,
+		},
+		{
+			name:     "forbidden-no-remaining",
+			response: &scm.Response{Status: http.StatusForbidden, Rate: scm.Rate{Limit: 5000, Remaining: 0}},
+			retried:  true,
+		},
+		{
+			name:      "forbidden",
+			response:  &scm.Response{Status: http.StatusForbidden, Rate: scm.Rate{Limit: 5000, Remaining: 100}},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, fakeData, pullRequests, fakeClock := newTestPullRequestCache(t)
+			fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 1)
+			pullRequests.responses = []*scm.Response{tc.response}
+			start := fakeClock.Now()
+
+			pr, err := c.Find(context.Background(), "https://fake.com/myowner/myrepo.git", "myowner", "myrepo", 1)
+			if tc.expectErr {
+				require.Error(t, err, "should not retry when the rate limit is not used up")
+				assert.Equal(t, 1, pullRequests.lists["myowner/myrepo"], "list calls")
+				assert.Zero(t, fakeClock.Since(start), "should not back off")
+				return
+			}
+			require.NoError(t, err, "should retry when rate limited")
+			assert.Equal(t, 1, pr.Number, "pull request number")
+			assert.Equal(t, 2, pullRequests.lists["myowner/myrepo"], "list calls")
+			assert.Positive(t, fakeClock.Since(start), "should back off using the clock")
+		})
+	}
+}
+
+func TestPullRequestCacheWaitsForRateLimitReset(t *testing.T) {
+	testCases := []struct {
+		name     string
+		reset    time.Duration
+		expected time.Duration
+	}{
+		{
+			name:     "reset",
+			reset:    30 * time.Second,
+			expected: 30 * time.Second,
+		},
+		{
+			name:     "timeout",
+			reset:    time.Hour,
+			expected: time.Minute,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, fakeData, pullRequests, fakeClock := newTestPullRequestCache(t)
+			fakescms.CreatePullRequest(fakeData, "myowner", "myrepo", 1).Closed = true
+			start := fakeClock.Now()
+			pullRequests.responses = []*scm.Response{
+				{
+					Status: http.StatusOK,
+					Rate:   scm.Rate{Limit: 5000, Remaining: 0, Reset: start.Add(tc.reset).Unix()},
+				},
+			}
+
+			pr, err := c.Find(context.Background(), "https://fake.com/myowner/myrepo.git", "myowner", "myrepo", 1)
+			require.NoError(t, err, "failed to find pull request")
+			assert.True(t, pr.Closed, "pull request should be closed")
+			assert.Equal(t, tc.expected, fakeClock.Since(start), "time waited before querying the closed pull request")
+		})
+	}
+}
+
+func TestPullRequestCacheRefExists(t *testing.T) {
+	testCases := []struct {
+		name      string
+		ref       string
+		err       error
+		exists    bool
+		calls     []string
+		expectErr bool
+	}{
+		{
+			name:   "branch",
+			ref:    "release-1.2",
+			exists: true,
+			calls:  []string{"branch:release-1.2"},
+		},
+		{
+			name:   "tag",
+			ref:    "v1.2.0",
+			exists: true,
+			calls:  []string{"branch:v1.2.0", "tag:v1.2.0"},
+		},
+		{
+			name:  "removed",
+			ref:   "old-feature",
+			calls: []string{"branch:old-feature", "tag:old-feature"},
+		},
+		{
+			name:      "error",
+			ref:       "release-1.2",
+			err:       errors.New("server error"),
+			calls:     []string{"branch:release-1.2"},
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _, _, _ := newTestPullRequestCache(t)
+			server, err := c.gitServer("https://fake.com/myowner/myrepo.git")
+			require.NoError(t, err, "failed to find the git server")
+			refs := &fakeRefs{
+				GitService: server.client.Git,
+				branches:   map[string]bool{"release-1.2": true},
+				tags:       map[string]bool{"v1.2.0": true},
+				err:        tc.err,
+			}
+			server.client.Git = refs
+
+			exists, err := c.RefExists(context.Background(), "https://fake.com/myowner/myrepo.git", "myowner", "myrepo", tc.ref)
+			if tc.expectErr {
+				require.Error(t, err, "should fail if the branch cannot be queried")
+			} else {
+				require.NoError(t, err, "failed to check ref %s", tc.ref)
+			}
+			assert.Equal(t, tc.exists, exists, "ref exists")
+			assert.Equal(t, tc.calls, refs.calls, "calls")
+		})
+	}
+}
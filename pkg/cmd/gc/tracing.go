@@ -0,0 +1,11 @@
+package gc
+
+import (
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
+)
+
+// startPhase starts the next phase of the garbage collection so that previews destroyed during it are traced within its span
+func (o *Options) startPhase(phases *tracing.Phases, name string) {
+	phases.Start(name)
+	o.ParentSpan = phases.Span()
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/jenkins-x-plugins/jx-preview/pkg/rootcmd"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/scmhelpers"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
@@ -31,6 +32,7 @@ type Options struct {
 	LatestCommit  string
 	OutputEnvVars map[string]string
 
+	Output  string
 	Current bool
 	Wait    bool
 }
@@ -44,6 +46,9 @@ var (
 		# List all preview environments
 		%s get
 
+		# List all preview environments with their last deploy
+		%s get -o wide
+
 		# View the current preview environment URL
 		# inside a CI pipeline
 		%s get --current
@@ -58,13 +63,14 @@ func NewCmdGetPreview() (*cobra.Command, *Options) {
 		Short:   "Display one or more Previews",
 		Aliases: []string{"list"},
 		Long:    cmdLong,
-		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName),
+		Example: fmt.Sprintf(cmdExample, rootcmd.BinaryName, rootcmd.BinaryName, rootcmd.BinaryName),
 		Run: func(_ *cobra.Command, _ []string) {
 			err := options.Run()
 			helper.CheckErr(err)
 		},
 	}
 
+	cmd.Flags().StringVarP(&options.Output, "output", "o", "", "The output format. Use 'wide' to include the last deploy of each preview")
 	cmd.Flags().BoolVarP(&options.Current, "current", "c", false, "Output the URL of the current Preview application the current pipeline just deployed")
 	cmd.Flags().BoolVarP(&options.Wait, "wait", "w", false, "Waits for a preview deployment with commit hash that matches latest commit")
 	return cmd, options
@@ -93,12 +99,30 @@ func (o *Options) Run() error {
 	resources := resourceList.Items
 	previews.SortPreviews(resources)
 
+	wide := o.Output == "wide"
 	t := table.CreateTable(os.Stdout)
-	t.AddRow("PULL REQUEST", "NAMESPACE", "APPLICATION")
+	if wide {
+		t.AddRow("PULL REQUEST", "NAMESPACE", "APPLICATION", "COMMIT", "OUTCOME", "DEPLOYED")
+	} else {
+		t.AddRow("PULL REQUEST", "NAMESPACE", "APPLICATION")
+	}
 
 	for k := range resources {
 		preview := resources[k]
-		t.AddRow(preview.Spec.PullRequest.URL, preview.Spec.Resources.Namespace, preview.Spec.Resources.URL)
+		if !wide {
+			t.AddRow(preview.Spec.PullRequest.URL, preview.Spec.Resources.Namespace, preview.Spec.Resources.URL)
+			continue
+		}
+		commit, outcome, deployed := "", "", ""
+		deploy := previews.LastDeploy(&preview)
+		if deploy != nil {
+			commit = previews.ShortCommit(deploy.Commit)
+			outcome = string(deploy.Outcome)
+			if deploy.EndTime != nil {
+				deployed = deploy.EndTime.Format(time.RFC3339)
+			}
+		}
+		t.AddRow(preview.Spec.PullRequest.URL, preview.Spec.Resources.Namespace, preview.Spec.Resources.URL, commit, outcome, deployed)
 	}
 	t.Render()
 	return nil
@@ -106,6 +130,12 @@ func (o *Options) Run() error {
 
 // Validate validates the inputs are valid
 func (o *Options) Validate() error {
+	switch o.Output {
+	case "", "wide":
+	default:
+		return options.InvalidOption("output", o.Output, []string{"wide"})
+	}
+
 	var err error
 	o.PreviewClient, o.Namespace, err = previews.LazyCreatePreviewClientAndNamespace(o.PreviewClient, o.Namespace)
 	if err != nil {
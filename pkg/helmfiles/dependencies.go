@@ -0,0 +1,96 @@
+package helmfiles
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DependenciesKey the key of the inline values of the default environment of a preview helmfile listing its dependencies
+	DependenciesKey = "previewDependencies"
+
+	// DefaultDependencyEnvironment the environment the versions of dependencies are taken from by default
+	DefaultDependencyEnvironment = "staging"
+)
+
+// Dependency a release of another application deployed into the preview namespace at the version promoted to an environment
+type Dependency struct {
+	// Name the name of the release or chart in the helmfile of the environment
+	Name string `json:"name"`
+
+	// Environment the name of the environment to take the version from. Defaults to staging
+	Environment string `json:"environment,omitempty"`
+}
+
+// EnvironmentName returns the name of the environment to take the version of the dependency from
+func (d *Dependency) EnvironmentName() string {
+	if d.Environment == "" {
+		return DefaultDependencyEnvironment
+	}
+	return d.Environment
+}
+
+type environmentsDocument struct {
+	Environments map[string]struct {
+		Values []interface{} `json:"values,omitempty"`
+	} `json:"environments,omitempty"`
+}
+
+// LoadDependencies loads the dependencies declared in the previewDependencies inline values of the default
+// environment of the preview helmfile. Only the documents declaring dependencies are parsed as the others may be templates
+func LoadDependencies(path string) ([]Dependency, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read helmfile %s: %w", path, err)
+	}
+	var answer []Dependency
+	for _, doc := range splitDocuments(string(data)) {
+		if !strings.Contains(doc, DependenciesKey) {
+			continue
+		}
+		envs := &environmentsDocument{}
+		err = yaml.Unmarshal([]byte(doc), envs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the environments of helmfile %s: %w", path, err)
+		}
+		for _, v := range envs.Environments["default"].Values {
+			m, ok := v.(map[string]interface{})
+			if !ok || m[DependenciesKey] == nil {
+				continue
+			}
+			value, err := yaml.Marshal(m[DependenciesKey])
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal the %s of helmfile %s: %w", DependenciesKey, path, err)
+			}
+			var dependencies []Dependency
+			err = yaml.Unmarshal(value, &dependencies)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the %s of helmfile %s: %w", DependenciesKey, path, err)
+			}
+			answer = append(answer, dependencies...)
+		}
+	}
+	for i := range answer {
+		if answer[i].Name == "" {
+			return nil, fmt.Errorf("dependency %d of helmfile %s has no name", i+1, path)
+		}
+	}
+	return answer, nil
+}
+
+func splitDocuments(text string) []string {
+	var docs []string
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "---" {
+			docs = append(docs, strings.Join(lines, "\n"))
+			lines = nil
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return append(docs, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,86 @@
+package helmfiles
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Helmfile the subset of a helmfile.yaml used to resolve and deploy the releases of an environment
+type Helmfile struct {
+	Repositories []Repository `json:"repositories,omitempty"`
+	Releases     []Release    `json:"releases,omitempty"`
+}
+
+// Repository a chart repository of a helmfile
+type Repository struct {
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	OCI      bool   `json:"oci,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Release a release of a helmfile
+type Release struct {
+	Name      string        `json:"name"`
+	Chart     string        `json:"chart"`
+	Version   string        `json:"version,omitempty"`
+	Namespace string        `json:"namespace,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// LoadHelmfile loads the releases and repositories of the helmfile
+func LoadHelmfile(path string) (*Helmfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read helmfile %s: %w", path, err)
+	}
+	answer := &Helmfile{}
+	err = yaml.Unmarshal(data, answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse helmfile %s: %w", path, err)
+	}
+	return answer, nil
+}
+
+// SaveHelmfile saves the helmfile
+func SaveHelmfile(path string, helmfile *Helmfile) error {
+	data, err := yaml.Marshal(helmfile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal helmfile: %w", err)
+	}
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save helmfile %s: %w", path, err)
+	}
+	return nil
+}
+
+// FindRelease finds the release with the given name or whose chart has the given name
+func (h *Helmfile) FindRelease(name string) *Release {
+	for i := range h.Releases {
+		if h.Releases[i].Name == name {
+			return &h.Releases[i]
+		}
+	}
+	for i := range h.Releases {
+		chart := h.Releases[i].Chart
+		if chart == name || strings.HasSuffix(chart, "/"+name) {
+			return &h.Releases[i]
+		}
+	}
+	return nil
+}
+
+// FindRepository finds the repository with the given name
+func (h *Helmfile) FindRepository(name string) *Repository {
+	for i := range h.Repositories {
+		if h.Repositories[i].Name == name {
+			return &h.Repositories[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package helmfiles_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadHelmfile(t *testing.T) {
+	helmfile, err := helmfiles.LoadHelmfile(filepath.Join("test_data", "helmfile.yaml"))
+	require.NoError(t, err, "failed to load helmfile")
+
+	release := helmfile.FindRelease("backend")
+	require.NotNil(t, release, "should find release by name")
+	assert.Equal(t, "1.2.3", release.Version, "backend version")
+
+	release = helmfile.FindRelease("payments")
+	require.NotNil(t, release, "should find release by chart name")
+	assert.Equal(t, "my-payments", release.Name, "payments release name")
+
+	assert.Nil(t, helmfile.FindRelease("missing"), "should not find a missing release")
+
+	repo := helmfile.FindRepository("dev")
+	require.NotNil(t, repo, "should find the dev repository")
+	assert.Equal(t, "http://bucketrepo.jx.svc.cluster.local/bucketrepo/charts/", repo.URL, "dev repository URL")
+
+	file := filepath.Join(t.TempDir(), "helmfile.yaml")
+	err = helmfiles.SaveHelmfile(file, helmfile)
+	require.NoError(t, err, "failed to save helmfile")
+	saved, err := helmfiles.LoadHelmfile(file)
+	require.NoError(t, err, "failed to load saved helmfile")
+	assert.Equal(t, helmfile, saved, "saved helmfile")
+}
+
+func TestLoadDependencies(t *testing.T) {
+	dependencies, err := helmfiles.LoadDependencies(filepath.Join("test_data", "preview", "helmfile.yaml.gotmpl"))
+	require.NoError(t, err, "failed to load dependencies")
+	require.Equal(t, []helmfiles.Dependency{{Name: "backend"}, {Name: "payments", Environment: "production"}}, dependencies, "dependencies")
+	assert.Equal(t, helmfiles.DefaultDependencyEnvironment, dependencies[0].EnvironmentName(), "default environment")
+	assert.Equal(t, "production", dependencies[1].EnvironmentName(), "environment")
+
+	dependencies, err = helmfiles.LoadDependencies(filepath.Join("test_data", "helmfile.yaml"))
+	require.NoError(t, err, "failed to load a helmfile without dependencies")
+	assert.Empty(t, dependencies, "dependencies")
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
@@ -43,3 +44,41 @@ func ListReleases(runner cmdrunner.CommandRunner, file string, env map[string]st
 	}
 	return answer, nil
 }
+
+// helmStatus the subset of the output of helm status
+type helmStatus struct {
+	Version int `json:"version"`
+}
+
+// GetReleaseRevision returns the current revision of the helm release
+func GetReleaseRevision(runner cmdrunner.CommandRunner, name, namespace string) (int, error) {
+	var b bytes.Buffer
+	c := &cmdrunner.Command{
+		Name: "helm",
+		Args: []string{"status", name, "--namespace", namespace, "--output", "json"},
+		Out:  &b,
+	}
+	_, err := runner(c)
+	if err != nil {
+		return 0, fmt.Errorf("failed to run %s: %w", c.CLI(), err)
+	}
+	status := &helmStatus{}
+	err = json.Unmarshal(b.Bytes(), status)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse JSON: %s: %w", b.String(), err)
+	}
+	return status.Version, nil
+}
+
+// RollbackRelease rolls the helm release back to the revision
+func RollbackRelease(runner cmdrunner.CommandRunner, name, namespace string, revision int) error {
+	c := &cmdrunner.Command{
+		Name: "helm",
+		Args: []string{"rollback", name, strconv.Itoa(revision), "--namespace", namespace, "--wait"},
+	}
+	_, err := runner(c)
+	if err != nil {
+		return fmt.Errorf("failed to run %s: %w", c.CLI(), err)
+	}
+	return nil
+}
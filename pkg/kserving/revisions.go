@@ -0,0 +1,167 @@
+package kserving
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+	kserve "knative.dev/serving/pkg/client/clientset/versioned"
+)
+
+const (
+	// CommitTagPrefix the prefix of the traffic tags of commits
+	CommitTagPrefix = "sha-"
+
+	// MaxCommitTags the maximum number of commit traffic tags kept on a Service
+	MaxCommitTags = 5
+
+	commitTagLength = 7
+)
+
+// CommitTag returns the traffic tag of the commit
+func CommitTag(sha string) string {
+	sha = strings.ToLower(sha)
+	if len(sha) > commitTagLength {
+		sha = sha[:commitTagLength]
+	}
+	return CommitTagPrefix + sha
+}
+
+// TagLatestRevision waits for the revision of the Knative Service created by the latest deploy to become Ready then
+// adds a traffic tag for it. Older commit tags are removed so that at most MaxCommitTags are kept.
+// Returns the name of the revision and the URL of the tag
+func TagLatestRevision(ctx context.Context, client kserve.Interface, kubeClient kubernetes.Interface, ns, name, tag string, timeout time.Duration) (string, string, error) {
+	services := client.ServingV1().Services(ns)
+
+	// lets wait for the Service to observe the latest deploy so we know which revision it created
+	revisionName := ""
+	err := retry(timeout, func() error {
+		svc, err := services.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if svc.Status.ObservedGeneration < svc.Generation || svc.Status.LatestCreatedRevisionName == "" {
+			return fmt.Errorf("knative service %s has not created the revision yet", name)
+		}
+		revisionName = svc.Status.LatestCreatedRevisionName
+		return nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to find the latest revision of knative service %s in namespace %s: %w", name, ns, err)
+	}
+
+	log.Logger().Infof("waiting for revision %s of knative service %s to be ready", revisionName, name)
+	err = retry(timeout, func() error {
+		rev, err := client.ServingV1().Revisions(ns).Get(ctx, revisionName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if rev.IsFailed() {
+			return backoff.Permanent(fmt.Errorf("revision %s failed", revisionName))
+		}
+		if !rev.IsReady() {
+			return fmt.Errorf("revision %s is not ready", revisionName)
+		}
+		return nil
+	})
+	if err != nil {
+		return revisionName, "", fmt.Errorf("failed to wait for revision %s in namespace %s%s: %w", revisionName, ns, describeRevisionPods(ctx, kubeClient, ns, revisionName), err)
+	}
+
+	svc, err := services.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return revisionName, "", fmt.Errorf("failed to get knative service %s in namespace %s: %w", name, ns, err)
+	}
+	svc.Spec.Traffic = AddTrafficTag(svc.Spec.Traffic, tag, revisionName)
+	_, err = services.Update(ctx, svc, metav1.UpdateOptions{})
+	if err != nil {
+		return revisionName, "", fmt.Errorf("failed to update the traffic of knative service %s in namespace %s: %w", name, ns, err)
+	}
+
+	tagURL := ""
+	err = retry(timeout, func() error {
+		svc, err := services.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		for i := range svc.Status.Traffic {
+			t := &svc.Status.Traffic[i]
+			if t.Tag == tag && t.RevisionName == revisionName && t.URL != nil {
+				tagURL = t.URL.String()
+				return nil
+			}
+		}
+		return fmt.Errorf("knative service %s has no URL for tag %s yet", name, tag)
+	})
+	if err != nil {
+		return revisionName, "", fmt.Errorf("failed to find the URL of tag %s of knative service %s in namespace %s: %w", tag, name, ns, err)
+	}
+	return revisionName, tagURL, nil
+}
+
+// AddTrafficTag adds or replaces the traffic target of the tag pinned to the revision. All traffic is routed to the
+// latest revision if no traffic is configured and only the most recent MaxCommitTags commit tags are kept
+func AddTrafficTag(traffic []v1.TrafficTarget, tag, revisionName string) []v1.TrafficTarget {
+	var answer []v1.TrafficTarget
+	hasDefault := false
+	var commitTags []v1.TrafficTarget
+	for i := range traffic {
+		t := traffic[i]
+		switch {
+		case t.Tag == tag:
+			continue
+		case strings.HasPrefix(t.Tag, CommitTagPrefix) && (t.LatestRevision == nil || !*t.LatestRevision):
+			commitTags = append(commitTags, t)
+			continue
+		}
+		if t.Percent != nil && *t.Percent > 0 {
+			hasDefault = true
+		}
+		answer = append(answer, t)
+	}
+	if !hasDefault {
+		latest := true
+		percent := int64(100)
+		answer = append([]v1.TrafficTarget{{LatestRevision: &latest, Percent: &percent}}, answer...)
+	}
+
+	if len(commitTags) >= MaxCommitTags {
+		commitTags = commitTags[len(commitTags)-MaxCommitTags+1:]
+	}
+	answer = append(answer, commitTags...)
+	latest := false
+	return append(answer, v1.TrafficTarget{
+		Tag:            tag,
+		RevisionName:   revisionName,
+		LatestRevision: &latest,
+	})
+}
+
+// describeRevisionPods describes the phase of the pods of the revision to help diagnose why it is not ready
+func describeRevisionPods(ctx context.Context, kubeClient kubernetes.Interface, ns, revisionName string) string {
+	if kubeClient == nil {
+		return ""
+	}
+	pods, err := kubeClient.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{LabelSelector: RevisionLabel + "=" + revisionName})
+	if err != nil || len(pods.Items) == 0 {
+		return ""
+	}
+	var phases []string
+	for i := range pods.Items {
+		phases = append(phases, fmt.Sprintf("%s is %s", pods.Items[i].Name, pods.Items[i].Status.Phase))
+	}
+	return " (pods: " + strings.Join(phases, ", ") + ")"
+}
+
+func retry(timeout time.Duration, fn func() error) error {
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = timeout
+	bo.Reset()
+	return backoff.Retry(fn, bo)
+}
@@ -0,0 +1,43 @@
+package kserving_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/kserving"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "knative.dev/serving/pkg/apis/serving/v1"
+)
+
+func TestCommitTag(t *testing.T) {
+	assert.Equal(t, "sha-abc1234", kserving.CommitTag("ABC1234567890"))
+	assert.Equal(t, "sha-abc", kserving.CommitTag("abc"))
+}
+
+func TestAddTrafficTag(t *testing.T) {
+	traffic := kserving.AddTrafficTag(nil, "sha-0000000", "myapp-00001")
+	require.Len(t, traffic, 2, "traffic")
+	require.NotNil(t, traffic[0].LatestRevision, "default traffic target")
+	assert.True(t, *traffic[0].LatestRevision, "default traffic should follow the latest revision")
+	assert.Equal(t, int64(100), *traffic[0].Percent, "default traffic percent")
+	assert.Equal(t, "sha-0000000", traffic[1].Tag, "commit tag")
+	assert.Equal(t, "myapp-00001", traffic[1].RevisionName, "commit tag revision")
+
+	// re-tagging the same commit replaces the tag
+	traffic = kserving.AddTrafficTag(traffic, "sha-0000000", "myapp-00002")
+	require.Len(t, traffic, 2, "traffic")
+	assert.Equal(t, "myapp-00002", traffic[1].RevisionName, "commit tag revision")
+
+	for i := 1; i <= 2*kserving.MaxCommitTags; i++ {
+		traffic = kserving.AddTrafficTag(traffic, fmt.Sprintf("sha-%07d", i), fmt.Sprintf("myapp-%05d", i+2))
+	}
+	require.Len(t, traffic, kserving.MaxCommitTags+1, "only the most recent commit tags should be kept")
+	last := traffic[len(traffic)-1]
+	assert.Equal(t, fmt.Sprintf("sha-%07d", 2*kserving.MaxCommitTags), last.Tag, "latest commit tag")
+
+	// custom traffic is kept
+	other := v1.TrafficTarget{Tag: "stable", RevisionName: "myapp-00001"}
+	traffic = kserving.AddTrafficTag(append(traffic, other), "sha-1111111", "myapp-00020")
+	assert.Contains(t, traffic, other, "custom traffic target")
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// EnvPushgatewayURL the environment variable for the URL of the Pushgateway to push the metrics to
+	EnvPushgatewayURL = "JX_PREVIEW_METRICS_PUSHGATEWAY_URL"
+
+	// EnvTextfile the environment variable for the file to write the metrics to for the node exporter textfile collector
+	EnvTextfile = "JX_PREVIEW_METRICS_TEXTFILE"
+
+	// Job the job name of the metrics pushed to a Pushgateway
+	Job = "jx-preview"
+
+	pushTimeout = 30 * time.Second
+)
+
+// Options the options for exporting the metrics of a command
+type Options struct {
+	PushgatewayURL string
+	Textfile       string
+	HTTPClient     *http.Client
+}
+
+// AddFlags adds the metrics flags to the command
+func (o *Options) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.PushgatewayURL, "metrics-pushgateway", "", os.Getenv(EnvPushgatewayURL), "The URL of a Pushgateway to push the preview metrics to. Defaults to $"+EnvPushgatewayURL)
+	cmd.Flags().StringVarP(&o.Textfile, "metrics-textfile", "", os.Getenv(EnvTextfile), "The file to write the preview metrics to for the node exporter textfile collector. Defaults to $"+EnvTextfile)
+}
+
+// Export pushes the metrics to the Pushgateway and/or writes them to the textfile if configured.
+// The command is used as a grouping key so that the metrics of different commands do not replace each other
+func (o *Options) Export(gatherer prometheus.Gatherer, command string) error {
+	if o.PushgatewayURL != "" {
+		client := o.HTTPClient
+		if client == nil {
+			client = &http.Client{Timeout: pushTimeout}
+		}
+		err := Push(client, gatherer, o.PushgatewayURL, command)
+		if err != nil {
+			return err
+		}
+	}
+	if o.Textfile != "" {
+		err := prometheus.WriteToTextfile(o.Textfile, gatherer)
+		if err != nil {
+			return fmt.Errorf("failed to write metrics to %s: %w", o.Textfile, err)
+		}
+	}
+	return nil
+}
+
+// Push pushes the metrics to the Pushgateway replacing the metrics with the same names in the group of the command
+func Push(client *http.Client, gatherer prometheus.Gatherer, pushgatewayURL, command string) error {
+	err := push.New(pushgatewayURL, Job).
+		Gatherer(gatherer).
+		Grouping("command", command).
+		Client(client).
+		Add()
+	if err != nil {
+		return fmt.Errorf("failed to push metrics to %s: %w", pushgatewayURL, err)
+	}
+	return nil
+}
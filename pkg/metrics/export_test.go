@@ -0,0 +1,84 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	r := prometheus.NewRegistry()
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "jx_test_failures_total", Help: "The number of failures."}, []string{"reason"})
+	r.MustRegister(failures)
+	failures.WithLabelValues("deploy").Inc()
+
+	var path, method string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		method = req.Method
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	textfile := filepath.Join(t.TempDir(), "jx-preview.prom")
+	o := &metrics.Options{
+		PushgatewayURL: server.URL + "/",
+		Textfile:       textfile,
+	}
+	err := o.Export(r, "create")
+	require.NoError(t, err, "failed to export metrics")
+
+	assert.Equal(t, http.MethodPost, method, "push method")
+	assert.Equal(t, "/metrics/job/jx-preview/command/create", path, "push path")
+
+	data, err := os.ReadFile(textfile)
+	require.NoError(t, err, "failed to read textfile")
+	assert.Contains(t, string(data), `jx_test_failures_total{reason="deploy"} 1`, "textfile metrics")
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	})
+	err = o.Export(r, "create")
+	require.Error(t, err, "push should fail")
+	assert.Contains(t, err.Error(), "bad metrics")
+}
+
+func TestPreviewMetrics(t *testing.T) {
+	metrics.Failures.WithLabelValues("create", "deploy").Inc()
+	metrics.CreateDuration.WithLabelValues("myorg", "myrepo", metrics.Outcome(errors.New("failed"))).Observe(90)
+	metrics.Previews.WithLabelValues("myorg", "myrepo").Set(3)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.Failures.WithLabelValues("create", "deploy")), "failures")
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.Previews.WithLabelValues("myorg", "myrepo")), "previews")
+
+	err := testutil.GatherAndCompare(metrics.Default, strings.NewReader(`# HELP jx_preview_create_duration_seconds The duration in seconds of creating or updating a preview.
+# TYPE jx_preview_create_duration_seconds histogram
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="10"} 0
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="30"} 0
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="60"} 0
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="120"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="300"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="600"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="900"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="1200"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="1800"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="3600"} 1
+jx_preview_create_duration_seconds_bucket{outcome="failed",owner="myorg",repository="myrepo",le="+Inf"} 1
+jx_preview_create_duration_seconds_sum{outcome="failed",owner="myorg",repository="myrepo"} 90
+jx_preview_create_duration_seconds_count{outcome="failed",owner="myorg",repository="myrepo"} 1
+`), "jx_preview_create_duration_seconds")
+	assert.NoError(t, err, "create duration")
+
+	metrics.Previews.Reset()
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.Previews), "previews should be reset")
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DurationBuckets the histogram buckets in seconds for the duration of creating and destroying previews
+var DurationBuckets = []float64{10, 30, 60, 120, 300, 600, 900, 1200, 1800, 3600}
+
+var (
+	// Default the registry of the preview metrics
+	Default = prometheus.NewRegistry()
+
+	factory = promauto.With(Default)
+
+	// Previews the number of previews of each repository
+	Previews = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jx_preview_previews",
+		Help: "The number of previews of each repository.",
+	}, []string{"owner", "repository"})
+
+	// CreateDuration the duration of creating or updating a preview
+	CreateDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jx_preview_create_duration_seconds",
+		Help:    "The duration in seconds of creating or updating a preview.",
+		Buckets: DurationBuckets,
+	}, []string{"owner", "repository", "outcome"})
+
+	// DestroyDuration the duration of destroying a preview
+	DestroyDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jx_preview_destroy_duration_seconds",
+		Help:    "The duration in seconds of destroying a preview.",
+		Buckets: DurationBuckets,
+	}, []string{"outcome"})
+
+	// Failures the number of failed commands by the step which failed
+	Failures = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "jx_preview_failures_total",
+		Help: "The number of failures of each command by reason.",
+	}, []string{"command", "reason"})
+
+	// GCActions the number of previews and namespaces acted on by the garbage collector
+	GCActions = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "jx_preview_gc_actions_total",
+		Help: "The number of actions taken by the preview garbage collector.",
+	}, []string{"action"})
+)
+
+const (
+	// OutcomeSucceeded the outcome label value of a successful command
+	OutcomeSucceeded = "succeeded"
+
+	// OutcomeFailed the outcome label value of a failed command
+	OutcomeFailed = "failed"
+)
+
+// Outcome returns the outcome label value of the error of a command
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeFailed
+	}
+	return OutcomeSucceeded
+}
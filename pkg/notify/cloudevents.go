@@ -0,0 +1,63 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	// CloudEventsSpecVersion the version of the CloudEvents specification of the events
+	CloudEventsSpecVersion = "1.0"
+
+	// CloudEventsContentType the content type of structured CloudEvents
+	CloudEventsContentType = "application/cloudevents+json"
+
+	// CloudEventTypePrefix the prefix of the types of the CloudEvents of previews e.g. dev.jenkins-x.preview.ready
+	CloudEventTypePrefix = "dev.jenkins-x.preview."
+)
+
+// CloudEvent a structured mode CloudEvent, see https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/formats/json-format.md
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype,omitempty"`
+
+	// the extension attributes allow subscribers such as Knative Triggers to filter the events of a repository
+	Owner       string `json:"owner,omitempty"`
+	Repository  string `json:"repository,omitempty"`
+	PullRequest string `json:"pullrequest,omitempty"`
+
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ToCloudEvent converts the event to a CloudEvent whose source is the namespace of the preview
+func ToCloudEvent(event *Event) *CloudEvent {
+	answer := &CloudEvent{
+		SpecVersion:     CloudEventsSpecVersion,
+		ID:              newEventID(),
+		Source:          "/apis/preview.jenkins.io/v1alpha1/namespaces/" + event.Namespace + "/previews",
+		Type:            CloudEventTypePrefix + string(event.Type),
+		Subject:         event.Preview,
+		Time:            event.Time,
+		DataContentType: "application/json",
+		Owner:           event.Owner,
+		Repository:      event.Repository,
+		Data:            event,
+	}
+	if event.PullRequest > 0 {
+		answer.PullRequest = strconv.Itoa(event.PullRequest)
+	}
+	return answer
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
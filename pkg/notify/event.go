@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+)
+
+// EventType the type of a lifecycle event of a preview
+type EventType string
+
+const (
+	// EventReady the preview was deployed and is ready to use
+	EventReady EventType = "ready"
+
+	// EventFailed the preview failed to deploy
+	EventFailed EventType = "failed"
+
+	// EventRolledBack the preview failed to deploy and was rolled back to its last successful deploy
+	EventRolledBack EventType = "rolledback"
+
+	// EventDestroyed the preview was destroyed
+	EventDestroyed EventType = "destroyed"
+)
+
+// EventTypes the types of all the lifecycle events. There is no hibernate event as previews are never scaled down
+var EventTypes = []EventType{EventReady, EventFailed, EventRolledBack, EventDestroyed}
+
+// Event a lifecycle event of a preview
+type Event struct {
+	Type             EventType `json:"type"`
+	Time             time.Time `json:"time"`
+	Preview          string    `json:"preview"`
+	Namespace        string    `json:"namespace"`
+	PreviewNamespace string    `json:"previewNamespace,omitempty"`
+	Owner            string    `json:"owner,omitempty"`
+	Repository       string    `json:"repository,omitempty"`
+	PullRequest      int       `json:"pullRequest,omitempty"`
+	PullRequestURL   string    `json:"pullRequestURL,omitempty"`
+	Branch           string    `json:"branch,omitempty"`
+	Commit           string    `json:"commit,omitempty"`
+	URL              string    `json:"url,omitempty"`
+	Message          string    `json:"message,omitempty"`
+
+	// Spec the spec of the preview including all of its URLs
+	Spec *v1alpha1.PreviewSpec `json:"spec,omitempty"`
+}
+
+// NewEvent creates an event of the preview
+func NewEvent(eventType EventType, preview *v1alpha1.Preview, message string) *Event {
+	spec := &preview.Spec
+	event := &Event{
+		Type:             eventType,
+		Time:             time.Now().UTC(),
+		Preview:          preview.Name,
+		Namespace:        preview.Namespace,
+		PreviewNamespace: spec.Resources.Namespace,
+		Owner:            spec.PullRequest.Owner,
+		Repository:       spec.PullRequest.Repository,
+		PullRequest:      spec.PullRequest.Number,
+		PullRequestURL:   spec.PullRequest.URL,
+		Commit:           spec.PullRequest.LatestCommit,
+		URL:              spec.Resources.URL,
+		Message:          message,
+	}
+	if spec.Branch != nil {
+		event.Branch = spec.Branch.Name
+	}
+
+	// the destroy command is omitted as its environment may contain credentials
+	event.Spec = spec.DeepCopy()
+	event.Spec.DestroyCommand = v1alpha1.Command{}
+	return event
+}
+
+// Title returns a short description of the event
+func (e *Event) Title() string {
+	switch e.Type {
+	case EventReady:
+		return "preview " + e.Preview + " is ready"
+	case EventFailed:
+		return "preview " + e.Preview + " failed to deploy"
+	case EventRolledBack:
+		return "preview " + e.Preview + " failed to deploy and was rolled back"
+	case EventDestroyed:
+		return "preview " + e.Preview + " was destroyed"
+	default:
+		return "preview " + e.Preview + " " + string(e.Type)
+	}
+}
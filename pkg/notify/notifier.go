@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EnvSink the environment variable injected by a Knative SinkBinding with the URL to send CloudEvents to
+const EnvSink = "K_SINK"
+
+// Notifier sends the lifecycle events of previews somewhere such as to webhooks
+type Notifier interface {
+	// Notify sends the event
+	Notify(event *Event) error
+}
+
+// Notifiers sends events to each of the notifiers
+type Notifiers []Notifier
+
+// Notify sends the event to all of the notifiers even if some of them fail
+func (n Notifiers) Notify(event *Event) error {
+	var errs []error
+	for _, notifier := range n {
+		err := notifier.Notify(event)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewNotifier creates a notifier for the webhooks of the notifications configuration. URLs are read from
+// Secrets in the namespace of the previews
+func NewNotifier(kubeClient kubernetes.Interface, ns string, notifications []previewconfig.Notification) (Notifiers, error) {
+	var answer Notifiers
+	for i := range notifications {
+		n := &notifications[i]
+		webhook, err := newWebhook(kubeClient, ns, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notification %d: %w", i+1, err)
+		}
+		answer = append(answer, webhook)
+	}
+	return answer, nil
+}
+
+// LazyCreateNotifier creates a notifier from the preview configuration in the namespace if one is not already configured.
+// If the notifications cannot be configured a warning is logged as they should not stop previews being created or destroyed
+func LazyCreateNotifier(notifier Notifier, kubeClient kubernetes.Interface, ns string, config *previewconfig.Config) Notifier {
+	if notifier != nil {
+		return notifier
+	}
+	var err error
+	if config == nil {
+		config, err = previewconfig.LoadConfig(kubeClient, ns)
+		if err != nil {
+			log.Logger().Warnf("failed to load the preview configuration so only $%s will be notified: %s", EnvSink, err.Error())
+			config = &previewconfig.Config{}
+		}
+	}
+	answer, err := NewNotifier(kubeClient, ns, config.Notifications)
+	if err != nil {
+		log.Logger().Warnf("failed to configure notifications so none will be sent: %s", err.Error())
+		answer = Notifiers{}
+	}
+	sink := NewSink(config.CloudEvents)
+	if sink != nil {
+		answer = append(answer, sink)
+	}
+	return answer
+}
+
+// NewSink creates a notifier which publishes CloudEvents to the configured sink or $K_SINK
+// or returns nil if there is no sink
+func NewSink(config *previewconfig.CloudEvents) *Webhook {
+	sinkURL := os.Getenv(EnvSink)
+	if config != nil && config.Sink != "" {
+		sinkURL = config.Sink
+	}
+	if sinkURL == "" {
+		return nil
+	}
+	return &Webhook{
+		Name:    "cloudevents-sink",
+		URL:     sinkURL,
+		Format:  previewconfig.NotificationFormatCloudEvents,
+		Retries: config.GetRetries(),
+	}
+}
+
+func newWebhook(kubeClient kubernetes.Interface, ns string, n *previewconfig.Notification) (*Webhook, error) {
+	webhookURL := n.URL
+	if n.URLSecret != nil {
+		ctx := context.Background()
+		secret, err := kubeClient.CoreV1().Secrets(ns).Get(ctx, n.URLSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Secret %s in namespace %s: %w", n.URLSecret.Name, ns, err)
+		}
+		webhookURL = strings.TrimSpace(string(secret.Data[n.URLSecret.Key]))
+		if webhookURL == "" {
+			return nil, fmt.Errorf("no key %s in Secret %s in namespace %s", n.URLSecret.Key, n.URLSecret.Name, ns)
+		}
+	}
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL")
+	}
+
+	webhook := &Webhook{
+		Name:    n.Name,
+		URL:     webhookURL,
+		Format:  n.GetFormat(),
+		Headers: n.Headers,
+		Retries: n.GetRetries(),
+	}
+	if webhook.Name == "" {
+		webhook.Name = u.Host
+	}
+	for _, e := range n.Events {
+		eventType, err := toEventType(e)
+		if err != nil {
+			return nil, err
+		}
+		webhook.Events = append(webhook.Events, eventType)
+	}
+	return webhook, nil
+}
+
+func toEventType(text string) (EventType, error) {
+	for _, t := range EventTypes {
+		if string(t) == text {
+			return t, nil
+		}
+	}
+	var names []string
+	for _, t := range EventTypes {
+		names = append(names, string(t))
+	}
+	return "", fmt.Errorf("unknown notification event %q. Supported values are %s", text, strings.Join(names, ", "))
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+)
+
+const (
+	// DefaultRetryDelay the delay before the first retry of a failed delivery which doubles for each retry
+	DefaultRetryDelay = time.Second
+
+	requestTimeout = 30 * time.Second
+)
+
+// Webhook an HTTP endpoint notified of the events of previews
+type Webhook struct {
+	Name    string
+	URL     string
+	Format  previewconfig.NotificationFormat
+	Events  []EventType
+	Headers map[string]string
+
+	// Retries the number of times delivery is retried if the request fails or the webhook returns a server error
+	Retries    int
+	RetryDelay time.Duration
+	HTTPClient *http.Client
+}
+
+// Accepts returns true if the webhook should be sent the type of event
+func (w *Webhook) Accepts(eventType EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, t := range w.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notify sends the event to the webhook retrying with an exponential backoff if delivery fails
+func (w *Webhook) Notify(event *Event) error {
+	if !w.Accepts(event.Type) {
+		return nil
+	}
+	body, contentType, err := w.encode(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event for webhook %s: %w", event.Type, w.Name, err)
+	}
+
+	delay := w.RetryDelay
+	if delay <= 0 {
+		delay = DefaultRetryDelay
+	}
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.send(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.Retries {
+			return fmt.Errorf("failed to notify webhook %s of %s event after %d attempts: %w", w.Name, event.Type, attempt+1, err)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send sends the request returning whether it should be retried if it fails
+func (w *Webhook) send(body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	client := w.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+}
+
+// encode returns the body and content type of the request for the event in the format of the webhook
+func (w *Webhook) encode(event *Event) ([]byte, string, error) {
+	switch w.Format {
+	case previewconfig.NotificationFormatCloudEvents:
+		data, err := json.Marshal(ToCloudEvent(event))
+		return data, CloudEventsContentType, err
+	case previewconfig.NotificationFormatSlack:
+		data, err := json.Marshal(map[string]string{"text": SlackText(event)})
+		return data, "application/json", err
+	default:
+		data, err := json.Marshal(event)
+		return data, "application/json", err
+	}
+}
+
+// SlackText returns the event as a message using Slack mrkdwn formatting
+func SlackText(event *Event) string {
+	icon := ":information_source:"
+	switch event.Type {
+	case EventReady:
+		icon = ":rocket:"
+	case EventFailed:
+		icon = ":x:"
+	case EventRolledBack:
+		icon = ":warning:"
+	case EventDestroyed:
+		icon = ":wastebasket:"
+	}
+
+	title := event.Title()
+	if event.URL != "" && event.Type == EventReady {
+		title = fmt.Sprintf("<%s|%s>", event.URL, title)
+	}
+	text := icon + " " + title
+
+	var source string
+	switch {
+	case event.PullRequestURL != "":
+		source = fmt.Sprintf("<%s|%s/%s#%d>", event.PullRequestURL, event.Owner, event.Repository, event.PullRequest)
+	case event.Branch != "":
+		source = fmt.Sprintf("%s/%s branch %s", event.Owner, event.Repository, event.Branch)
+	case event.Repository != "":
+		source = event.Owner + "/" + event.Repository
+	}
+	if source != "" {
+		text += " for " + source
+	}
+	if event.Message != "" {
+		text += "\n" + event.Message
+	}
+	return text
+}
@@ -0,0 +1,212 @@
+package notify_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/notify"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+type request struct {
+	contentType string
+	auth        string
+	body        map[string]interface{}
+}
+
+func newServer(t *testing.T, failures int) (*httptest.Server, *[]request) {
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, _ := io.ReadAll(req.Body)
+		r := request{
+			contentType: req.Header.Get("Content-Type"),
+			auth:        req.Header.Get("Authorization"),
+		}
+		assert.NoError(t, json.Unmarshal(data, &r.body), "failed to parse request body")
+		requests = append(requests, r)
+		if len(requests) <= failures {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newPreview() *v1alpha1.Preview {
+	return &v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-pr-123",
+			Namespace: "jx",
+		},
+		Spec: v1alpha1.PreviewSpec{
+			PullRequest: v1alpha1.PullRequest{
+				Number:       123,
+				Owner:        "myorg",
+				Repository:   "myrepo",
+				URL:          "https://github.com/myorg/myrepo/pull/123",
+				LatestCommit: "abc1234",
+			},
+			Resources: v1alpha1.Resources{
+				Namespace: "jx-myorg-myrepo-pr-123",
+				URL:       "https://myrepo-pr-123.example.com",
+			},
+		},
+	}
+}
+
+func TestWebhookFormats(t *testing.T) {
+	server, requests := newServer(t, 0)
+	event := notify.NewEvent(notify.EventReady, newPreview(), "")
+
+	for _, format := range []previewconfig.NotificationFormat{previewconfig.NotificationFormatJSON, previewconfig.NotificationFormatCloudEvents, previewconfig.NotificationFormatSlack} {
+		w := &notify.Webhook{
+			Name:    string(format),
+			URL:     server.URL,
+			Format:  format,
+			Headers: map[string]string{"Authorization": "Bearer token"},
+		}
+		err := w.Notify(event)
+		require.NoError(t, err, "failed to notify %s webhook", format)
+	}
+	require.Len(t, *requests, 3, "requests")
+
+	jsonRequest := (*requests)[0]
+	assert.Equal(t, "application/json", jsonRequest.contentType, "json content type")
+	assert.Equal(t, "Bearer token", jsonRequest.auth, "json headers")
+	assert.Equal(t, "ready", jsonRequest.body["type"], "json type")
+	assert.Equal(t, "https://myrepo-pr-123.example.com", jsonRequest.body["url"], "json url")
+	assert.Equal(t, float64(123), jsonRequest.body["pullRequest"], "json pull request")
+
+	cloudEvent := (*requests)[1]
+	assert.Equal(t, notify.CloudEventsContentType, cloudEvent.contentType, "cloudevents content type")
+	assert.Equal(t, "1.0", cloudEvent.body["specversion"], "cloudevents specversion")
+	assert.Equal(t, "dev.jenkins-x.preview.ready", cloudEvent.body["type"], "cloudevents type")
+	assert.Equal(t, "myorg-myrepo-pr-123", cloudEvent.body["subject"], "cloudevents subject")
+	assert.NotEmpty(t, cloudEvent.body["id"], "cloudevents id")
+	data, ok := cloudEvent.body["data"].(map[string]interface{})
+	require.True(t, ok, "cloudevents data")
+	assert.Equal(t, "jx-myorg-myrepo-pr-123", data["previewNamespace"], "cloudevents data preview namespace")
+
+	slack := (*requests)[2]
+	assert.Equal(t, ":rocket: <https://myrepo-pr-123.example.com|preview myorg-myrepo-pr-123 is ready> for <https://github.com/myorg/myrepo/pull/123|myorg/myrepo#123>", slack.body["text"], "slack text")
+}
+
+func TestWebhookRetries(t *testing.T) {
+	server, requests := newServer(t, 2)
+	event := notify.NewEvent(notify.EventDestroyed, newPreview(), "the pull request was merged")
+
+	w := &notify.Webhook{
+		Name:       "retries",
+		URL:        server.URL,
+		Retries:    2,
+		RetryDelay: 1,
+	}
+	err := w.Notify(event)
+	require.NoError(t, err, "delivery should succeed after retries")
+	assert.Len(t, *requests, 3, "requests")
+
+	w.Retries = 1
+	err = w.Notify(event)
+	require.NoError(t, err, "the server only fails the first two requests")
+
+	server, requests = newServer(t, 10)
+	w.URL = server.URL
+	err = w.Notify(event)
+	require.Error(t, err, "delivery should fail when the retries are exhausted")
+	assert.Len(t, *requests, 2, "requests when retries are exhausted")
+
+	w.Events = []notify.EventType{notify.EventReady}
+	err = w.Notify(event)
+	require.NoError(t, err, "events not accepted by the webhook are ignored")
+	assert.Len(t, *requests, 2, "requests for ignored events")
+}
+
+func TestNewNotifier(t *testing.T) {
+	server, requests := newServer(t, 0)
+	ns := "jx"
+	kubeClient := fakekube.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "slack-webhook",
+			Namespace: ns,
+		},
+		Data: map[string][]byte{
+			"url": []byte(server.URL + "\n"),
+		},
+	})
+
+	notifier, err := notify.NewNotifier(kubeClient, ns, []previewconfig.Notification{
+		{
+			Format:    previewconfig.NotificationFormatSlack,
+			URLSecret: &previewconfig.SecretKey{Name: "slack-webhook", Key: "url"},
+			Events:    []string{"failed"},
+		},
+		{
+			URL: server.URL,
+		},
+	})
+	require.NoError(t, err, "failed to create notifier")
+	require.Len(t, notifier, 2, "webhooks")
+
+	err = notifier.Notify(notify.NewEvent(notify.EventFailed, newPreview(), "helmfile sync failed"))
+	require.NoError(t, err, "failed to notify")
+	require.Len(t, *requests, 2, "requests")
+	assert.Equal(t, ":x: preview myorg-myrepo-pr-123 failed to deploy for <https://github.com/myorg/myrepo/pull/123|myorg/myrepo#123>\nhelmfile sync failed", (*requests)[0].body["text"], "slack text")
+
+	_, err = notify.NewNotifier(kubeClient, ns, []previewconfig.Notification{{URL: server.URL, Events: []string{"created"}}})
+	assert.Error(t, err, "unknown events should be invalid")
+
+	_, err = notify.NewNotifier(kubeClient, ns, []previewconfig.Notification{{URLSecret: &previewconfig.SecretKey{Name: "missing", Key: "url"}}})
+	assert.Error(t, err, "missing secrets should be invalid")
+}
+
+func TestSink(t *testing.T) {
+	server, requests := newServer(t, 0)
+	ns := "jx"
+	t.Setenv(notify.EnvSink, "")
+
+	notifier := notify.LazyCreateNotifier(nil, fakekube.NewSimpleClientset(), ns, &previewconfig.Config{})
+	assert.Empty(t, notifier, "no sink should be configured")
+
+	t.Setenv(notify.EnvSink, server.URL)
+	notifier = notify.LazyCreateNotifier(nil, fakekube.NewSimpleClientset(), ns, nil)
+	require.Len(t, notifier, 1, "the sink should default to $K_SINK")
+
+	preview := newPreview()
+	preview.Spec.Resources.URLs = []v1alpha1.PreviewURL{{Name: "docs", URL: "https://docs-pr-123.example.com"}}
+	preview.Spec.DestroyCommand = v1alpha1.Command{Command: "helmfile", Env: []v1alpha1.EnvVar{{Name: "GIT_TOKEN", Value: "secret"}}}
+	err := notifier.Notify(notify.NewEvent(notify.EventReady, preview, ""))
+	require.NoError(t, err, "failed to publish event")
+
+	require.Len(t, *requests, 1, "requests")
+	cloudEvent := (*requests)[0]
+	assert.Equal(t, notify.CloudEventsContentType, cloudEvent.contentType, "content type")
+	assert.Equal(t, "dev.jenkins-x.preview.ready", cloudEvent.body["type"], "type")
+	assert.Equal(t, "myrepo", cloudEvent.body["repository"], "repository extension")
+	assert.Equal(t, "123", cloudEvent.body["pullrequest"], "pull request extension")
+
+	data, err := json.Marshal(cloudEvent.body["data"])
+	require.NoError(t, err, "failed to marshal data")
+	event := &notify.Event{}
+	require.NoError(t, json.Unmarshal(data, event), "failed to parse data")
+	require.NotNil(t, event.Spec, "the spec of the preview should be included")
+	assert.Equal(t, preview.Spec.Resources.URLs, event.Spec.Resources.URLs, "preview URLs")
+	assert.Empty(t, event.Spec.DestroyCommand.Env, "the destroy command should be omitted")
+
+	retries := 0
+	config := &previewconfig.Config{CloudEvents: &previewconfig.CloudEvents{Sink: server.URL + "/broker", Retries: &retries}}
+	sink := notify.NewSink(config.CloudEvents)
+	require.NotNil(t, sink, "sink")
+	assert.Equal(t, server.URL+"/broker", sink.URL, "the configured sink should override $K_SINK")
+	assert.Equal(t, 0, sink.Retries, "retries")
+}
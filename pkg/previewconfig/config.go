@@ -0,0 +1,543 @@
+package previewconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigMapName the name of the ConfigMap created by the jx-preview chart to configure previews
+	ConfigMapName = "jx-preview-config"
+
+	// ConfigMapKey the key in the ConfigMap containing the configuration YAML
+	ConfigMapKey = "config.yaml"
+
+	// RepositoryConfigFileName the file in the preview folder of a repository which overrides the configuration
+	RepositoryConfigFileName = "preview-config.yaml"
+
+	// DefaultAuthUsername the default basic authentication user name
+	DefaultAuthUsername = "preview"
+
+	// DefaultNotificationRetries the default number of times delivery of a notification is retried
+	DefaultNotificationRetries = 3
+)
+
+// QuotaPolicy what to do when creating a preview would exceed a quota
+type QuotaPolicy string
+
+const (
+	// QuotaPolicyRefuse refuses to create the preview and comments on the pull request
+	QuotaPolicyRefuse QuotaPolicy = "refuse"
+
+	// QuotaPolicyEvict destroys the least recently updated previews to make room for the new preview
+	QuotaPolicyEvict QuotaPolicy = "evict"
+)
+
+// Config the configuration of previews
+type Config struct {
+	// Quotas limits the number of previews. These cannot be overridden by repositories
+	Quotas Quotas `json:"quotas,omitempty"`
+
+	// ResourceQuota the resource quota applied to each preview namespace
+	ResourceQuota *corev1.ResourceQuotaSpec `json:"resourceQuota,omitempty"`
+
+	// LimitRange the default limits applied to containers in each preview namespace
+	LimitRange *corev1.LimitRangeSpec `json:"limitRange,omitempty"`
+
+	// NamespaceTemplate the go template used to name new preview namespaces. It can use .Namespace, .Owner,
+	// .Repository, .Number, .Branch and .Hash. Names longer than 63 characters are truncated and suffixed with .Hash.
+	// It cannot be overridden by a repository
+	NamespaceTemplate string `json:"namespaceTemplate,omitempty"`
+
+	// BranchNamespaceTemplate the go template used to name the namespaces of new branch previews. It cannot be overridden by a repository
+	BranchNamespaceTemplate string `json:"branchNamespaceTemplate,omitempty"`
+
+	// Copy the Secrets, ConfigMaps and ExternalSecrets copied into the preview namespace before deploying the preview
+	Copy *CopyResources `json:"copy,omitempty"`
+
+	// NetworkPolicy configures the NetworkPolicies which isolate preview namespaces from each other
+	NetworkPolicy *NetworkPolicy `json:"networkPolicy,omitempty"`
+
+	// TLS configures TLS for the Ingresses of previews
+	TLS *TLS `json:"tls,omitempty"`
+
+	// Auth configures authentication in front of the Ingresses of previews
+	Auth *Auth `json:"auth,omitempty"`
+
+	// Notifications the webhooks notified when previews are ready, fail to deploy or are destroyed
+	Notifications []Notification `json:"notifications,omitempty"`
+
+	// CloudEvents configures publishing the lifecycle events of previews to a broker. This cannot be overridden by repositories
+	CloudEvents *CloudEvents `json:"cloudEvents,omitempty"`
+}
+
+// CloudEvents configures publishing the lifecycle events of previews as CloudEvents to a sink such as a Knative broker
+type CloudEvents struct {
+	// Sink the URL the CloudEvents are posted to. Defaults to $K_SINK which is injected by a Knative SinkBinding
+	Sink string `json:"sink,omitempty"`
+
+	// Retries the number of times delivery is retried if the sink fails. Defaults to 3
+	Retries *int `json:"retries,omitempty"`
+}
+
+// NotificationFormat the format of the requests sent to a notification webhook
+type NotificationFormat string
+
+const (
+	// NotificationFormatJSON sends the event as JSON
+	NotificationFormatJSON NotificationFormat = "json"
+
+	// NotificationFormatCloudEvents sends the event as a structured CloudEvent
+	NotificationFormatCloudEvents NotificationFormat = "cloudevents"
+
+	// NotificationFormatSlack sends a Slack compatible message which can also be used with MS Teams incoming webhooks
+	NotificationFormatSlack NotificationFormat = "slack"
+)
+
+// Notification a webhook notified of the lifecycle events of previews
+type Notification struct {
+	// Name the name of the webhook used in logs. Defaults to the host of the URL
+	Name string `json:"name,omitempty"`
+
+	// URL the URL of the webhook
+	URL string `json:"url,omitempty"`
+
+	// URLSecret the key of a Secret in the namespace of the previews containing the URL of the webhook.
+	// Use this rather than url for webhooks such as Slack whose URL is a credential
+	URLSecret *SecretKey `json:"urlSecret,omitempty"`
+
+	// Format the format of the requests. Either json, cloudevents or slack. Defaults to json
+	Format NotificationFormat `json:"format,omitempty"`
+
+	// Events the events to send. Any of ready, failed, rolledback and destroyed. Defaults to all events
+	Events []string `json:"events,omitempty"`
+
+	// Headers additional HTTP headers sent with each request
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Retries the number of times delivery is retried if the webhook fails. Defaults to 3
+	Retries *int `json:"retries,omitempty"`
+}
+
+// SecretKey a key of a Secret
+type SecretKey struct {
+	// Name the name of the Secret
+	Name string `json:"name"`
+
+	// Key the key in the Secret
+	Key string `json:"key"`
+}
+
+// AuthMode how the Ingresses of previews are protected
+type AuthMode string
+
+const (
+	// AuthModeNone the Ingresses of previews are public
+	AuthModeNone AuthMode = "none"
+
+	// AuthModeBasic the Ingresses of previews use basic authentication with a generated password
+	AuthModeBasic AuthMode = "basic"
+
+	// AuthModeExternal the Ingresses of previews use an external authentication service such as oauth2-proxy
+	AuthModeExternal AuthMode = "external"
+)
+
+// Auth configures authentication in front of the Ingresses of previews. It requires the ingress-nginx controller
+type Auth struct {
+	// Mode how the Ingresses are protected. Either none, basic or external. Defaults to none
+	Mode AuthMode `json:"mode,omitempty"`
+
+	// Username the basic authentication user name. Defaults to preview
+	Username string `json:"username,omitempty"`
+
+	// URL the URL of the external authentication service. e.g. https://oauth2.example.com/oauth2/auth
+	URL string `json:"url,omitempty"`
+
+	// SignInURL the URL users are redirected to when the external authentication service refuses them.
+	// e.g. https://oauth2.example.com/oauth2/start?rd=$scheme://$host$escaped_request_uri
+	SignInURL string `json:"signInURL,omitempty"`
+}
+
+// TLS configures TLS for the Ingresses of previews using either a cert-manager issuer or an existing
+// wildcard certificate
+type TLS struct {
+	// Enabled whether the Ingresses of previews are configured for TLS
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Issuer the name of the cert-manager issuer which issues the certificates of previews
+	Issuer string `json:"issuer,omitempty"`
+
+	// IssuerKind the kind of the cert-manager issuer. Either ClusterIssuer or Issuer. Defaults to ClusterIssuer
+	IssuerKind string `json:"issuerKind,omitempty"`
+
+	// SecretName the name of an existing wildcard certificate Secret used instead of an issuer
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretNamespace the namespace of the wildcard certificate Secret which is copied into the preview namespace.
+	// If not specified the Secret must already exist in the preview namespace
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+}
+
+// CopyResources the resources copied into the preview namespace
+type CopyResources struct {
+	// Secrets the Secrets to copy
+	Secrets []CopyResource `json:"secrets,omitempty"`
+
+	// ConfigMaps the ConfigMaps to copy
+	ConfigMaps []CopyResource `json:"configMaps,omitempty"`
+
+	// ExternalSecrets the ExternalSecrets to copy so that the secrets are populated in the preview namespace
+	ExternalSecrets []CopyResource `json:"externalSecrets,omitempty"`
+
+	// AllowedSourceNamespaces the namespaces other than the namespace of the Previews which repositories can copy resources from.
+	// It cannot be overridden by a repository
+	AllowedSourceNamespaces []string `json:"allowedSourceNamespaces,omitempty"`
+}
+
+// CopyResource a resource copied into the preview namespace
+type CopyResource struct {
+	// Name the name of the resource to copy
+	Name string `json:"name"`
+
+	// Namespace the namespace of the resource. Defaults to the namespace of the Previews, usually jx
+	Namespace string `json:"namespace,omitempty"`
+
+	// TargetName the name of the copy in the preview namespace. Defaults to the name
+	TargetName string `json:"targetName,omitempty"`
+
+	// APIVersion the API version of an ExternalSecret. Defaults to external-secrets.io/v1beta1
+	APIVersion string `json:"apiVersion,omitempty"`
+}
+
+// NetworkPolicy configures the NetworkPolicies of preview namespaces. By default only traffic from the same namespace,
+// from the ingress controller and to DNS is allowed
+type NetworkPolicy struct {
+	// Enabled whether NetworkPolicies are installed in preview namespaces. It cannot be overridden by a repository
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// IngressControllerNamespaceSelector selects the namespaces of the ingress controllers which can reach the preview.
+	// It cannot be overridden by a repository
+	IngressControllerNamespaceSelector *metav1.LabelSelector `json:"ingressControllerNamespaceSelector,omitempty"`
+
+	// Ingress additional rules for incoming traffic to allow
+	Ingress []networkingv1.NetworkPolicyIngressRule `json:"ingress,omitempty"`
+
+	// Egress additional rules for outgoing traffic to allow
+	Egress []networkingv1.NetworkPolicyEgressRule `json:"egress,omitempty"`
+}
+
+const (
+	// IssuerKindClusterIssuer a cert-manager ClusterIssuer
+	IssuerKindClusterIssuer = "ClusterIssuer"
+
+	// IssuerKindIssuer a cert-manager Issuer in the preview namespace
+	IssuerKindIssuer = "Issuer"
+)
+
+// Quotas the limits on the number of previews. A value of zero means unlimited
+type Quotas struct {
+	// MaxPreviews the maximum number of previews in total
+	MaxPreviews int `json:"maxPreviews,omitempty"`
+
+	// MaxPreviewsPerRepository the maximum number of previews for a single repository
+	MaxPreviewsPerRepository int `json:"maxPreviewsPerRepository,omitempty"`
+
+	// MaxPreviewsPerAuthor the maximum number of previews for pull requests of a single author
+	MaxPreviewsPerAuthor int `json:"maxPreviewsPerAuthor,omitempty"`
+
+	// Policy what to do when a new preview would exceed a limit. Defaults to refuse
+	Policy QuotaPolicy `json:"policy,omitempty"`
+}
+
+// LoadConfig loads the preview configuration from the ConfigMap in the given namespace.
+// If there is no ConfigMap an empty configuration is returned
+func LoadConfig(kubeClient kubernetes.Interface, ns string) (*Config, error) {
+	config := &Config{}
+	ctx := context.Background()
+	cm, err := kubeClient.CoreV1().ConfigMaps(ns).Get(ctx, ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return config, nil
+		}
+		return nil, fmt.Errorf("failed to get ConfigMap %s in namespace %s: %w", ConfigMapName, ns, err)
+	}
+	text := cm.Data[ConfigMapKey]
+	if text == "" {
+		return config, nil
+	}
+	err = yaml.Unmarshal([]byte(text), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s in ConfigMap %s in namespace %s: %w", ConfigMapKey, ConfigMapName, ns, err)
+	}
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid ConfigMap %s in namespace %s: %w", ConfigMapName, ns, err)
+	}
+	return config, nil
+}
+
+// LoadRepositoryConfig loads the optional configuration file in the preview folder of a repository
+// and returns the configuration with the overrides from the repository applied
+func LoadRepositoryConfig(config *Config, dir string) (*Config, error) {
+	answer := *config
+	path := filepath.Join(dir, RepositoryConfigFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &answer, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	overrides := &Config{}
+	err = yaml.Unmarshal(data, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	err = answer.validateOverrides(overrides)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	answer.Merge(overrides)
+	err = answer.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return &answer, nil
+}
+
+// validateOverrides makes sure the untrusted configuration of a repository only copies resources from the namespace of the Previews
+// or the allowed source namespaces so that a pull request cannot copy Secrets from any namespace into its preview.
+// Repository webhooks must use a url as a pull request must not be able to read the Secrets of the namespace of the Previews
+func (c *Config) validateOverrides(overrides *Config) error {
+	var allowed []string
+	if c.Copy != nil {
+		allowed = c.Copy.AllowedSourceNamespaces
+	}
+	isAllowed := func(ns string) bool {
+		if ns == "" {
+			return true
+		}
+		for _, a := range allowed {
+			if a == ns {
+				return true
+			}
+		}
+		return false
+	}
+	if overrides.Copy != nil {
+		for _, list := range [][]CopyResource{overrides.Copy.Secrets, overrides.Copy.ConfigMaps, overrides.Copy.ExternalSecrets} {
+			for i := range list {
+				if !isAllowed(list[i].Namespace) {
+					return fmt.Errorf("cannot copy %s from namespace %s as it is not one of the allowedSourceNamespaces", list[i].Name, list[i].Namespace)
+				}
+			}
+		}
+	}
+	// the wildcard certificate of the default configuration can still be used
+	tls := overrides.TLS
+	if tls != nil && c.TLS != nil && tls.SecretName == c.TLS.SecretName && tls.SecretNamespace == c.TLS.SecretNamespace {
+		tls = nil
+	}
+	if tls != nil && !isAllowed(tls.SecretNamespace) {
+		return fmt.Errorf("cannot copy the tls secret %s from namespace %s as it is not one of the allowedSourceNamespaces", overrides.TLS.SecretName, overrides.TLS.SecretNamespace)
+	}
+	for i := range overrides.Notifications {
+		if overrides.Notifications[i].URLSecret != nil {
+			return fmt.Errorf("notification %d cannot use a urlSecret in the repository configuration, use a url instead", i)
+		}
+	}
+	return nil
+}
+
+// Merge applies the overrides from a repository configuration. The namespace templates are never overridden
+// as the repository configuration of a pull request is untrusted and destroying a preview deletes its namespace
+func (c *Config) Merge(overrides *Config) {
+	if overrides.ResourceQuota != nil {
+		c.ResourceQuota = overrides.ResourceQuota
+	}
+	if overrides.LimitRange != nil {
+		c.LimitRange = overrides.LimitRange
+	}
+	if overrides.Copy != nil {
+		cp := &CopyResources{}
+		if c.Copy != nil {
+			*cp = *c.Copy
+		}
+		// resources from the repository are copied as well as the defaults
+		cp.Secrets = append(append([]CopyResource{}, cp.Secrets...), overrides.Copy.Secrets...)
+		cp.ConfigMaps = append(append([]CopyResource{}, cp.ConfigMaps...), overrides.Copy.ConfigMaps...)
+		cp.ExternalSecrets = append(append([]CopyResource{}, cp.ExternalSecrets...), overrides.Copy.ExternalSecrets...)
+		c.Copy = cp
+	}
+	if overrides.NetworkPolicy != nil {
+		np := &NetworkPolicy{}
+		if c.NetworkPolicy != nil {
+			*np = *c.NetworkPolicy
+		}
+		o := overrides.NetworkPolicy
+		// repositories can only allow more traffic with extra rules and cannot disable the isolation of their previews
+		np.Ingress = append(append([]networkingv1.NetworkPolicyIngressRule{}, np.Ingress...), o.Ingress...)
+		np.Egress = append(append([]networkingv1.NetworkPolicyEgressRule{}, np.Egress...), o.Egress...)
+		c.NetworkPolicy = np
+	}
+	if overrides.TLS != nil {
+		c.TLS = overrides.TLS
+	}
+	if overrides.Auth != nil {
+		c.Auth = overrides.Auth
+	}
+	// webhooks from the repository are notified as well as the defaults
+	if len(overrides.Notifications) > 0 {
+		c.Notifications = append(append([]Notification{}, c.Notifications...), overrides.Notifications...)
+	}
+}
+
+// CopyResources returns the resources copied into the preview namespace including the wildcard certificate Secret
+// if it is in another namespace
+func (c *Config) CopyResources() *CopyResources {
+	answer := &CopyResources{}
+	if c.Copy != nil {
+		*answer = *c.Copy
+	}
+	if c.TLS.IsEnabled() && c.TLS.SecretName != "" && c.TLS.SecretNamespace != "" {
+		answer.Secrets = append(append([]CopyResource{}, answer.Secrets...), CopyResource{
+			Name:      c.TLS.SecretName,
+			Namespace: c.TLS.SecretNamespace,
+		})
+	}
+	return answer
+}
+
+// GetTargetName returns the name of the copy in the preview namespace
+func (r *CopyResource) GetTargetName() string {
+	if r.TargetName == "" {
+		return r.Name
+	}
+	return r.TargetName
+}
+
+// GetMode returns how the Ingresses of previews are protected
+func (a *Auth) GetMode() AuthMode {
+	if a == nil || a.Mode == "" {
+		return AuthModeNone
+	}
+	return a.Mode
+}
+
+// GetUsername returns the basic authentication user name
+func (a *Auth) GetUsername() string {
+	if a.Username == "" {
+		return DefaultAuthUsername
+	}
+	return a.Username
+}
+
+// GetFormat returns the format of the requests sent to the webhook
+func (n *Notification) GetFormat() NotificationFormat {
+	if n.Format == "" {
+		return NotificationFormatJSON
+	}
+	return n.Format
+}
+
+// GetRetries returns the number of times delivery is retried
+func (n *Notification) GetRetries() int {
+	if n.Retries == nil {
+		return DefaultNotificationRetries
+	}
+	return *n.Retries
+}
+
+// GetRetries returns the number of times delivery is retried
+func (c *CloudEvents) GetRetries() int {
+	if c == nil || c.Retries == nil {
+		return DefaultNotificationRetries
+	}
+	return *c.Retries
+}
+
+// IsEnabled returns true if the Ingresses of previews should be configured for TLS
+func (t *TLS) IsEnabled() bool {
+	return t != nil && t.Enabled
+}
+
+// GetIssuerKind returns the kind of the cert-manager issuer
+func (t *TLS) GetIssuerKind() string {
+	if t.IssuerKind == "" {
+		return IssuerKindClusterIssuer
+	}
+	return t.IssuerKind
+}
+
+// IsEnabled returns true if NetworkPolicies should be installed
+func (n *NetworkPolicy) IsEnabled() bool {
+	return n != nil && (n.Enabled == nil || *n.Enabled)
+}
+
+// Enabled returns true if any quota is configured
+func (q *Quotas) Enabled() bool {
+	return q.MaxPreviews > 0 || q.MaxPreviewsPerRepository > 0 || q.MaxPreviewsPerAuthor > 0
+}
+
+// Evict returns true if previews should be evicted rather than new previews being refused
+func (q *Quotas) Evict() bool {
+	return q.Policy == QuotaPolicyEvict
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	switch c.Quotas.Policy {
+	case "", QuotaPolicyRefuse, QuotaPolicyEvict:
+	default:
+		return fmt.Errorf("unknown quota policy %q. Supported values are %s and %s", c.Quotas.Policy, QuotaPolicyRefuse, QuotaPolicyEvict)
+	}
+	switch c.Auth.GetMode() {
+	case AuthModeNone, AuthModeBasic:
+	case AuthModeExternal:
+		if c.Auth.URL == "" {
+			return fmt.Errorf("auth mode %s requires a url", AuthModeExternal)
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q. Supported values are %s, %s and %s", c.Auth.Mode, AuthModeNone, AuthModeBasic, AuthModeExternal)
+	}
+	if c.TLS.IsEnabled() {
+		if c.TLS.Issuer == "" && c.TLS.SecretName == "" {
+			return fmt.Errorf("tls requires either an issuer or a secretName")
+		}
+		switch c.TLS.GetIssuerKind() {
+		case IssuerKindClusterIssuer, IssuerKindIssuer:
+		default:
+			return fmt.Errorf("unknown tls issuerKind %q. Supported values are %s and %s", c.TLS.IssuerKind, IssuerKindClusterIssuer, IssuerKindIssuer)
+		}
+	}
+	if c.Copy != nil {
+		for _, list := range [][]CopyResource{c.Copy.Secrets, c.Copy.ConfigMaps, c.Copy.ExternalSecrets} {
+			for i := range list {
+				if list[i].Name == "" {
+					return fmt.Errorf("copy resource %d has no name", i+1)
+				}
+			}
+		}
+	}
+	for i := range c.Notifications {
+		n := &c.Notifications[i]
+		if n.URL == "" && n.URLSecret == nil {
+			return fmt.Errorf("notification %d requires either a url or a urlSecret", i+1)
+		}
+		switch n.GetFormat() {
+		case NotificationFormatJSON, NotificationFormatCloudEvents, NotificationFormatSlack:
+		default:
+			return fmt.Errorf("unknown notification format %q. Supported values are %s, %s and %s", n.Format, NotificationFormatJSON, NotificationFormatCloudEvents, NotificationFormatSlack)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package previewconfig_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadConfig(t *testing.T) {
+	ns := "jx"
+	kubeClient := fakekube.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      previewconfig.ConfigMapName,
+			Namespace: ns,
+		},
+		Data: map[string]string{
+			previewconfig.ConfigMapKey: `quotas:
+  maxPreviewsPerRepository: 5
+  policy: evict
+resourceQuota:
+  hard:
+    pods: "10"
+limitRange:
+  limits:
+  - type: Container
+    default:
+      memory: 512Mi
+networkPolicy:
+  egress:
+  - ports:
+    - port: 5432
+copy:
+  secrets:
+  - name: db-credentials
+tls:
+  enabled: true
+  secretName: wildcard-tls
+  secretNamespace: cert-manager
+notifications:
+- name: slack
+  format: slack
+  urlSecret:
+    name: slack-webhook
+    key: url
+`,
+		},
+	})
+
+	config, err := previewconfig.LoadConfig(kubeClient, ns)
+	require.NoError(t, err, "failed to load config")
+	assert.Equal(t, 5, config.Quotas.MaxPreviewsPerRepository, "quotas.maxPreviewsPerRepository")
+	assert.True(t, config.Quotas.Evict(), "quotas.policy should evict")
+	require.NotNil(t, config.ResourceQuota, "resourceQuota")
+	assert.Equal(t, resource.MustParse("10"), config.ResourceQuota.Hard[corev1.ResourcePods], "resourceQuota.hard.pods")
+
+	// a repository without a config file uses the defaults
+	dir := t.TempDir()
+	repoConfig, err := previewconfig.LoadRepositoryConfig(config, dir)
+	require.NoError(t, err, "failed to load repository config")
+	assert.Equal(t, config, repoConfig, "repository config without overrides")
+
+	err = os.WriteFile(filepath.Join(dir, previewconfig.RepositoryConfigFileName), []byte(`quotas:
+  maxPreviewsPerRepository: 100
+namespaceTemplate: kube-system
+branchNamespaceTemplate: "{{ .Namespace }}"
+resourceQuota:
+  hard:
+    pods: "20"
+networkPolicy:
+  enabled: false
+  ingressControllerNamespaceSelector:
+    matchLabels:
+      kubernetes.io/metadata.name: kube-system
+  egress:
+  - ports:
+    - port: 443
+copy:
+  externalSecrets:
+  - name: api-keys
+auth:
+  mode: basic
+notifications:
+- url: https://hooks.example.com/previews
+  events:
+  - destroyed
+`), 0600)
+	require.NoError(t, err, "failed to write repository config")
+
+	repoConfig, err = previewconfig.LoadRepositoryConfig(config, dir)
+	require.NoError(t, err, "failed to load repository config")
+	assert.Equal(t, 5, repoConfig.Quotas.MaxPreviewsPerRepository, "repositories cannot override quotas")
+	assert.Empty(t, repoConfig.NamespaceTemplate, "repositories cannot override the namespace template")
+	assert.Empty(t, repoConfig.BranchNamespaceTemplate, "repositories cannot override the branch namespace template")
+	assert.Equal(t, resource.MustParse("20"), repoConfig.ResourceQuota.Hard[corev1.ResourcePods], "overridden resourceQuota.hard.pods")
+	assert.Equal(t, config.LimitRange, repoConfig.LimitRange, "limitRange should be inherited")
+	assert.Equal(t, resource.MustParse("10"), config.ResourceQuota.Hard[corev1.ResourcePods], "default config should not be modified")
+	assert.True(t, repoConfig.NetworkPolicy.IsEnabled(), "repositories cannot disable networkPolicy")
+	assert.Nil(t, repoConfig.NetworkPolicy.IngressControllerNamespaceSelector, "repositories cannot override the ingress controller namespace selector")
+	assert.Len(t, repoConfig.NetworkPolicy.Egress, 2, "repository egress rules should be added to the defaults")
+	assert.Len(t, config.NetworkPolicy.Egress, 1, "default egress rules should not be modified")
+	assert.Len(t, repoConfig.Copy.Secrets, 1, "default secrets should be copied")
+	assert.Len(t, repoConfig.Copy.ExternalSecrets, 1, "repository external secrets should be copied")
+	assert.Empty(t, config.Copy.ExternalSecrets, "default copy config should not be modified")
+	copied := repoConfig.CopyResources()
+	require.Len(t, copied.Secrets, 2, "the wildcard certificate should be copied")
+	assert.Equal(t, "cert-manager", copied.Secrets[1].Namespace, "wildcard certificate namespace")
+	assert.Len(t, repoConfig.Copy.Secrets, 1, "copy config should not be modified")
+
+	assert.Equal(t, previewconfig.AuthModeBasic, repoConfig.Auth.GetMode(), "repositories can enable auth")
+	assert.Equal(t, previewconfig.AuthModeNone, config.Auth.GetMode(), "auth should be disabled by default")
+
+	require.Len(t, repoConfig.Notifications, 2, "repository notifications should be added to the defaults")
+	assert.Equal(t, previewconfig.NotificationFormatSlack, repoConfig.Notifications[0].GetFormat(), "default notification format")
+	assert.Equal(t, previewconfig.NotificationFormatJSON, repoConfig.Notifications[1].GetFormat(), "repository notification format")
+	assert.Equal(t, previewconfig.DefaultNotificationRetries, repoConfig.Notifications[1].GetRetries(), "notification retries")
+	assert.Len(t, config.Notifications, 1, "default notifications should not be modified")
+
+	err = os.WriteFile(filepath.Join(dir, previewconfig.RepositoryConfigFileName), []byte(`notifications:
+- format: slack
+  urlSecret:
+    name: slack-webhook
+    key: url
+`), 0600)
+	require.NoError(t, err, "failed to write repository config")
+	_, err = previewconfig.LoadRepositoryConfig(config, dir)
+	require.Error(t, err, "repositories should not be able to read webhook URLs from Secrets")
+	assert.Contains(t, err.Error(), "urlSecret", "error")
+
+	invalid := &previewconfig.Config{Notifications: []previewconfig.Notification{{Format: previewconfig.NotificationFormatSlack}}}
+	assert.Error(t, invalid.Validate(), "a notification without a url should be invalid")
+
+	invalid = &previewconfig.Config{Notifications: []previewconfig.Notification{{URL: "https://hooks.example.com", Format: "xml"}}}
+	assert.Error(t, invalid.Validate(), "an unknown notification format should be invalid")
+
+	invalid = &previewconfig.Config{Auth: &previewconfig.Auth{Mode: previewconfig.AuthModeExternal}}
+	assert.Error(t, invalid.Validate(), "external auth without a url should be invalid")
+
+	invalid = &previewconfig.Config{TLS: &previewconfig.TLS{Enabled: true}}
+	assert.Error(t, invalid.Validate(), "tls without an issuer or secret should be invalid")
+
+	// missing ConfigMap
+	config, err = previewconfig.LoadConfig(fakekube.NewSimpleClientset(), ns)
+	require.NoError(t, err, "failed to load config without a ConfigMap")
+	assert.False(t, config.Quotas.Enabled(), "quotas should be disabled by default")
+	assert.False(t, config.NetworkPolicy.IsEnabled(), "networkPolicy should be disabled without a ConfigMap")
+}
+
+func TestRepositoryCopyNamespaces(t *testing.T) {
+	config := &previewconfig.Config{
+		Copy: &previewconfig.CopyResources{
+			AllowedSourceNamespaces: []string{"shared"},
+		},
+		TLS: &previewconfig.TLS{
+			Enabled:         true,
+			SecretName:      "wildcard-tls",
+			SecretNamespace: "cert-manager",
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		file    string
+		invalid bool
+	}{
+		{
+			name: "namespace of the previews",
+			file: `copy:
+  secrets:
+  - name: db-credentials
+`,
+		},
+		{
+			name: "allowed namespace",
+			file: `copy:
+  configMaps:
+  - name: settings
+    namespace: shared
+`,
+		},
+		{
+			name: "other namespace",
+			file: `copy:
+  secrets:
+  - name: cloud-credentials
+    namespace: kube-system
+`,
+			invalid: true,
+		},
+		{
+			name: "extended allowed namespaces",
+			file: `copy:
+  allowedSourceNamespaces:
+  - kube-system
+  externalSecrets:
+  - name: cloud-credentials
+    namespace: kube-system
+`,
+			invalid: true,
+		},
+		{
+			name: "default tls secret",
+			file: `tls:
+  enabled: true
+  secretName: wildcard-tls
+  secretNamespace: cert-manager
+`,
+		},
+		{
+			name: "other tls secret",
+			file: `tls:
+  enabled: true
+  secretName: cloud-credentials
+  secretNamespace: kube-system
+`,
+			invalid: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, previewconfig.RepositoryConfigFileName), []byte(tc.file), 0600)
+		require.NoError(t, err, "failed to write repository config for test %s", tc.name)
+
+		repoConfig, err := previewconfig.LoadRepositoryConfig(config, dir)
+		if tc.invalid {
+			assert.Error(t, err, "cross namespace copies should be rejected for test %s", tc.name)
+			continue
+		}
+		require.NoError(t, err, "failed to load repository config for test %s", tc.name)
+		assert.Equal(t, []string{"shared"}, repoConfig.Copy.AllowedSourceNamespaces, "allowed source namespaces for test %s", tc.name)
+	}
+}
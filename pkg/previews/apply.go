@@ -0,0 +1,136 @@
+package previews
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// FieldManager the field manager of the fields of a Preview applied when it is created or updated
+	FieldManager = "jx-preview"
+
+	// ResourcesFieldManager the field manager of the deployed resources of a Preview
+	ResourcesFieldManager = "jx-preview-resources"
+
+	// StatusFieldManager the field manager of the status of a Preview
+	StatusFieldManager = "jx-preview-status"
+
+	// LinksFieldManager the field manager of the linked pull requests of a Preview
+	LinksFieldManager = "jx-preview-links"
+
+	// GCFieldManager the field manager of the garbage collection annotations and labels of a Preview
+	GCFieldManager = "jx-preview-gc"
+)
+
+// ApplyPreview applies the metadata and spec of the preview using server-side apply so that the field manager
+// only owns the fields which are set in the preview. The apply is forced so the field manager takes over the fields
+// from any other field manager. If the preview has a resourceVersion it fails with a conflict if the preview has
+// been modified since it was read
+func ApplyPreview(client versioned.Interface, preview *v1alpha1.Preview, fieldManager string) (*v1alpha1.Preview, error) {
+	obj, err := applyConfiguration(preview)
+	if err != nil {
+		return nil, err
+	}
+	delete(obj, "status")
+	if preview.ResourceVersion != "" {
+		err = unstructured.SetNestedField(obj, preview.ResourceVersion, "metadata", "resourceVersion")
+		if err != nil {
+			return nil, fmt.Errorf("failed to set the resourceVersion of Preview %s: %w", preview.Name, err)
+		}
+	}
+	return apply(client, preview, fieldManager, obj)
+}
+
+// ApplyStatus applies the status of the preview using server-side apply.
+// It fails with a conflict if the preview has been modified since it was read
+func ApplyStatus(client versioned.Interface, preview *v1alpha1.Preview) (*v1alpha1.Preview, error) {
+	obj, err := applyConfiguration(preview)
+	if err != nil {
+		return nil, err
+	}
+	obj["metadata"] = map[string]interface{}{
+		"name":            preview.Name,
+		"namespace":       preview.Namespace,
+		"resourceVersion": preview.ResourceVersion,
+	}
+	delete(obj, "spec")
+	return apply(client, preview, StatusFieldManager, obj)
+}
+
+// PatchMetadata patches the given annotations and labels of the preview without modifying any other fields.
+// Annotations and labels with an empty value are removed
+func PatchMetadata(client versioned.Interface, ns, name, fieldManager string, annotations, labels map[string]string) (*v1alpha1.Preview, error) {
+	metadata := map[string]interface{}{}
+	for key, values := range map[string]map[string]string{"annotations": annotations, "labels": labels} {
+		if len(values) == 0 {
+			continue
+		}
+		patch := map[string]interface{}{}
+		for k, v := range values {
+			if v == "" {
+				patch[k] = nil
+			} else {
+				patch[k] = v
+			}
+		}
+		metadata[key] = patch
+	}
+	data, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the metadata of Preview %s: %w", name, err)
+	}
+	answer, err := client.PreviewV1alpha1().Previews(ns).Patch(context.Background(), name, types.MergePatchType, data, metav1.PatchOptions{FieldManager: fieldManager})
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch Preview %s in namespace %s: %w", name, ns, err)
+	}
+	return answer, nil
+}
+
+func apply(client versioned.Interface, preview *v1alpha1.Preview, fieldManager string, obj map[string]interface{}) (*v1alpha1.Preview, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal Preview %s: %w", preview.Name, err)
+	}
+	force := true
+	answer, err := client.PreviewV1alpha1().Previews(preview.Namespace).Patch(context.Background(), preview.Name, types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: fieldManager, Force: &force})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply Preview %s in namespace %s: %w", preview.Name, preview.Namespace, err)
+	}
+	return answer, nil
+}
+
+// applyConfiguration returns the preview without any empty fields so that it only includes the fields to be owned
+func applyConfiguration(preview *v1alpha1.Preview) (map[string]interface{}, error) {
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(preview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert Preview %s: %w", preview.Name, err)
+	}
+	obj["apiVersion"] = v1alpha1.SchemeGroupVersion.String()
+	obj["kind"] = "Preview"
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj, "metadata", "resourceVersion")
+	removeEmptyFields(obj)
+	return obj, nil
+}
+
+func removeEmptyFields(obj map[string]interface{}) {
+	for k, v := range obj {
+		child, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		removeEmptyFields(child)
+		if len(child) == 0 {
+			delete(obj, k)
+		}
+	}
+}
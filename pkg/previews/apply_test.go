@@ -0,0 +1,168 @@
+package previews_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x/go-scm/scm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestGetOrCreatePreview(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	client := fake.NewSimpleClientset()
+	pr := &scm.PullRequest{
+		Number: 1,
+		Title:  "my title",
+		Link:   "https://github.com/myowner/myrepo/pull/1",
+		Sha:    "abc",
+		Head:   scm.PullRequestBranch{Sha: "def"},
+		Base: scm.PullRequestBranch{
+			Repo: scm.Repository{Namespace: "myowner", Name: "myrepo", Link: "https://github.com/myowner/myrepo"},
+		},
+	}
+	destroyCmd := &v1alpha1.Command{Command: "helmfile"}
+
+	preview, created, err := previews.GetOrCreatePreview(client, ns, pr, destroyCmd, "https://github.com/myowner/myrepo.git", previewNamespace, "preview")
+	require.NoError(t, err, "failed to create preview")
+	assert.True(t, created, "preview should be created")
+	assert.Equal(t, previewNamespace, preview.Name, "preview name")
+	assert.Equal(t, "def", preview.Spec.PullRequest.LatestCommit, "latest commit")
+
+	// fields written by others are kept. The fake clientset does not track field managers so this only checks
+	// that the applied fields are merged rather than that the field managers own them
+	applied := &v1alpha1.Preview{ObjectMeta: metav1.ObjectMeta{Name: preview.Name, Namespace: ns}}
+	applied.Spec.Resources.URL = "https://myrepo-pr-1.example.com"
+	_, err = previews.ApplyPreview(client, applied, previews.ResourcesFieldManager)
+	require.NoError(t, err, "failed to apply resources")
+	_, err = previews.RecordDeploy(client, ns, preview.Name, &v1alpha1.PreviewDeploy{Commit: "def", Outcome: v1alpha1.DeployOutcomeSucceeded})
+	require.NoError(t, err, "failed to record deploy")
+
+	pr.Head.Sha = "ghi"
+	preview, created, err = previews.GetOrCreatePreview(client, ns, pr, destroyCmd, "https://github.com/myowner/myrepo.git", previewNamespace, "preview")
+	require.NoError(t, err, "failed to update preview")
+	assert.False(t, created, "preview should be updated")
+
+	preview, err = client.PreviewV1alpha1().Previews(ns).Get(context.Background(), preview.Name, metav1.GetOptions{})
+	require.NoError(t, err, "failed to get preview")
+	assert.Equal(t, "ghi", preview.Spec.PullRequest.LatestCommit, "latest commit")
+	assert.Equal(t, "abc", preview.Spec.Source.Ref, "source ref")
+	assert.Equal(t, "https://myrepo-pr-1.example.com", preview.Spec.Resources.URL, "resources URL")
+	assert.Equal(t, previewNamespace, preview.Spec.Resources.Namespace, "resources namespace")
+	assert.Equal(t, "def", preview.Status.ServingCommit, "serving commit")
+	assert.Len(t, preview.Status.History, 1, "history")
+}
+
+func TestGetOrCreatePreviewConcurrentUpdate(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	existing := &v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            previewNamespace,
+			Namespace:       ns,
+			ResourceVersion: "1",
+		},
+	}
+	existing.Spec.PullRequest = v1alpha1.PullRequest{Number: 1, Owner: "myowner", Repository: "myrepo", Title: "my title"}
+	client := fake.NewSimpleClientset(existing)
+	gvr := v1alpha1.SchemeGroupVersion.WithResource("previews")
+
+	applies := 0
+	client.PrependReactor("patch", "previews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		patch := action.(clienttesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		applies++
+		if applies == 1 {
+			// another field manager changes the title after the preview was read
+			other := existing.DeepCopy()
+			other.Spec.PullRequest.Title = "renamed"
+			other.Spec.Resources.URL = "https://myrepo-pr-1.example.com"
+			other.ResourceVersion = "2"
+			err := client.Tracker().Update(gvr, other, ns)
+			require.NoError(t, err, "failed to update preview")
+		}
+
+		// the API server rejects an apply of a stale resourceVersion
+		obj := map[string]interface{}{}
+		err := json.Unmarshal(patch.GetPatch(), &obj)
+		require.NoError(t, err, "failed to parse apply patch")
+		resourceVersion, _, _ := unstructured.NestedString(obj, "metadata", "resourceVersion")
+		current, err := client.Tracker().Get(gvr, ns, patch.GetName())
+		require.NoError(t, err, "failed to get preview")
+		if resourceVersion != "" && resourceVersion != current.(*v1alpha1.Preview).ResourceVersion {
+			return true, nil, apierrors.NewConflict(gvr.GroupResource(), patch.GetName(), errors.New("the object has been modified"))
+		}
+		return false, nil, nil
+	})
+
+	pr := &scm.PullRequest{
+		Number: 1,
+		Title:  "my title",
+		Link:   "https://github.com/myowner/myrepo/pull/1",
+		Head:   scm.PullRequestBranch{Sha: "def"},
+		Base: scm.PullRequestBranch{
+			Repo: scm.Repository{Namespace: "myowner", Name: "myrepo"},
+		},
+	}
+	preview, created, err := previews.GetOrCreatePreview(client, ns, pr, &v1alpha1.Command{Command: "helmfile"}, "https://github.com/myowner/myrepo.git", previewNamespace, "preview")
+	require.NoError(t, err, "failed to update preview")
+	assert.False(t, created, "preview should be updated")
+	assert.Equal(t, 2, applies, "the apply should be retried after the conflict")
+	assert.Equal(t, "renamed", preview.Spec.PullRequest.Title, "the title of the other field manager should not be overwritten")
+	assert.Equal(t, "https://myrepo-pr-1.example.com", preview.Spec.Resources.URL, "resources URL")
+	assert.Equal(t, "def", preview.Spec.PullRequest.LatestCommit, "latest commit")
+}
+
+func TestPatchMetadata(t *testing.T) {
+	ns := "jx"
+	client := fake.NewSimpleClientset(&v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "jx-myowner-myrepo-pr-1",
+			Namespace:   ns,
+			Annotations: map[string]string{previews.AnnotationGCFailures: "2", previews.AnnotationLastUpdated: "yesterday"},
+			Labels:      map[string]string{previews.LabelGCFailing: "true", "team": "a"},
+		},
+	})
+
+	preview, err := previews.PatchMetadata(client, ns, "jx-myowner-myrepo-pr-1", previews.GCFieldManager,
+		map[string]string{previews.AnnotationGCFailures: "", previews.AnnotationGCLastError: "timeout"},
+		map[string]string{previews.LabelGCFailing: ""})
+	require.NoError(t, err, "failed to patch preview")
+	assert.Equal(t, map[string]string{previews.AnnotationGCLastError: "timeout", previews.AnnotationLastUpdated: "yesterday"}, preview.Annotations, "annotations")
+	assert.Equal(t, map[string]string{"team": "a"}, preview.Labels, "labels")
+}
+
+func TestUpdateLinkedPullRequests(t *testing.T) {
+	ns := "jx"
+	existing := &v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jx-myowner-myrepo-pr-1",
+			Namespace: ns,
+		},
+	}
+	existing.Spec.Resources.URL = "https://myrepo-pr-1.example.com"
+	existing.Spec.LinkedPullRequests = []v1alpha1.PullRequest{{Owner: "myowner", Repository: "api", Number: 2}}
+	client := fake.NewSimpleClientset(existing)
+
+	preview, err := previews.UpdateLinkedPullRequests(client, ns, existing.Name, v1alpha1.PullRequest{Owner: "myowner", Repository: "ui", Number: 3})
+	require.NoError(t, err, "failed to update linked pull requests")
+	require.Len(t, preview.Spec.LinkedPullRequests, 2, "linked pull requests")
+	assert.Equal(t, "ui", preview.Spec.LinkedPullRequests[1].Repository, "added linked pull request")
+	assert.Equal(t, existing.Spec.Resources.URL, preview.Spec.Resources.URL, "resources URL")
+	assert.NotEmpty(t, preview.Annotations[previews.AnnotationLastUpdated], "last updated")
+}
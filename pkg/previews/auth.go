@@ -0,0 +1,197 @@
+package previews
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationAuth the annotation on preview Ingresses protected by jx-preview with the auth mode
+	AnnotationAuth = "preview.jenkins.io/auth"
+
+	// AnnotationNginxAuthType the ingress-nginx annotation for the type of authentication
+	AnnotationNginxAuthType = "nginx.ingress.kubernetes.io/auth-type"
+
+	// AnnotationNginxAuthSecret the ingress-nginx annotation for the Secret containing the htpasswd file
+	AnnotationNginxAuthSecret = "nginx.ingress.kubernetes.io/auth-secret"
+
+	// AnnotationNginxAuthRealm the ingress-nginx annotation for the basic authentication realm
+	AnnotationNginxAuthRealm = "nginx.ingress.kubernetes.io/auth-realm"
+
+	// AnnotationNginxAuthURL the ingress-nginx annotation for the URL of an external authentication service
+	AnnotationNginxAuthURL = "nginx.ingress.kubernetes.io/auth-url"
+
+	// AnnotationNginxAuthSignIn the ingress-nginx annotation for the sign in URL of an external authentication service
+	AnnotationNginxAuthSignIn = "nginx.ingress.kubernetes.io/auth-signin"
+
+	// AuthSecretName the name of the Secret containing the basic authentication credentials of a preview
+	AuthSecretName = "jx-preview-basic-auth"
+
+	// AuthRealm the basic authentication realm of previews
+	AuthRealm = "Preview"
+
+	passwordLength = 18
+)
+
+// authAnnotations the annotations managed on protected Ingresses
+var authAnnotations = []string{
+	AnnotationAuth,
+	AnnotationNginxAuthType,
+	AnnotationNginxAuthSecret,
+	AnnotationNginxAuthRealm,
+	AnnotationNginxAuthURL,
+	AnnotationNginxAuthSignIn,
+}
+
+// Credentials the basic authentication credentials of a preview
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// ProtectIngresses adds the authentication annotations to the Ingresses in the preview namespace.
+// For basic authentication the credentials are generated once per preview, stored in a Secret and returned.
+// If authentication is disabled any previous protection is removed
+func ProtectIngresses(kubeClient kubernetes.Interface, previewNamespace string, cfg *previewconfig.Auth) (*Credentials, error) {
+	mode := cfg.GetMode()
+	var credentials *Credentials
+	var err error
+	annotations := map[string]string{}
+	switch mode {
+	case previewconfig.AuthModeBasic:
+		credentials, err = ensureBasicAuthSecret(kubeClient, previewNamespace, cfg.GetUsername())
+		if err != nil {
+			return nil, err
+		}
+		annotations[AnnotationNginxAuthType] = "basic"
+		annotations[AnnotationNginxAuthSecret] = AuthSecretName
+		annotations[AnnotationNginxAuthRealm] = AuthRealm
+	case previewconfig.AuthModeExternal:
+		annotations[AnnotationNginxAuthURL] = cfg.URL
+		if cfg.SignInURL != "" {
+			annotations[AnnotationNginxAuthSignIn] = cfg.SignInURL
+		}
+	default:
+		err = kubeClient.CoreV1().Secrets(previewNamespace).Delete(context.Background(), AuthSecretName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to delete Secret %s in namespace %s: %w", AuthSecretName, previewNamespace, err)
+		}
+	}
+
+	ctx := context.Background()
+	ingressInterface := kubeClient.NetworkingV1().Ingresses(previewNamespace)
+	list, err := ingressInterface.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ingresses in namespace %s: %w", previewNamespace, err)
+	}
+	for i := range list.Items {
+		ing := &list.Items[i]
+		if mode == previewconfig.AuthModeNone && ing.Annotations[AnnotationAuth] == "" {
+			continue
+		}
+		if ing.Annotations == nil {
+			ing.Annotations = map[string]string{}
+		}
+		if ing.Annotations[AnnotationAuth] != "" {
+			// lets remove the previous protection in case the mode changed
+			for _, k := range authAnnotations {
+				delete(ing.Annotations, k)
+			}
+		}
+		if mode != previewconfig.AuthModeNone {
+			ing.Annotations[AnnotationAuth] = string(mode)
+			for k, v := range annotations {
+				ing.Annotations[k] = v
+			}
+		}
+		_, err = ingressInterface.Update(ctx, ing, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update Ingress %s in namespace %s: %w", ing.Name, previewNamespace, err)
+		}
+		log.Logger().Infof("configured %s authentication for Ingress %s in namespace %s", info(string(mode)), info(ing.Name), info(previewNamespace))
+	}
+	return credentials, nil
+}
+
+// ensureBasicAuthSecret creates the basic authentication Secret if it does not exist or is for another user
+func ensureBasicAuthSecret(kubeClient kubernetes.Interface, previewNamespace, username string) (*Credentials, error) {
+	ctx := context.Background()
+	secretInterface := kubeClient.CoreV1().Secrets(previewNamespace)
+	secret, err := secretInterface.Get(ctx, AuthSecretName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to get Secret %s in namespace %s: %w", AuthSecretName, previewNamespace, err)
+		}
+		secret = nil
+	}
+	if secret != nil && string(secret.Data["username"]) == username && len(secret.Data["password"]) > 0 {
+		return &Credentials{Username: username, Password: string(secret.Data["password"])}, nil
+	}
+
+	password, err := generatePassword()
+	if err != nil {
+		return nil, err
+	}
+	htpasswd, err := HTPasswd(username, password)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		"auth":     []byte(htpasswd),
+		"username": []byte(username),
+		"password": []byte(password),
+	}
+	if secret == nil {
+		_, err = secretInterface.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      AuthSecretName,
+				Namespace: previewNamespace,
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: data,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Secret %s in namespace %s: %w", AuthSecretName, previewNamespace, err)
+		}
+	} else {
+		secret.Data = data
+		_, err = secretInterface.Update(ctx, secret, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update Secret %s in namespace %s: %w", AuthSecretName, previewNamespace, err)
+		}
+	}
+	return &Credentials{Username: username, Password: password}, nil
+}
+
+// HTPasswd returns the htpasswd line for the user using a salted SHA1 hash
+func HTPasswd(username, password string) (string, error) {
+	salt := make([]byte, 8)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	h := sha1.New() //nolint:gosec
+	h.Write([]byte(password))
+	h.Write(salt)
+	hash := append(h.Sum(nil), salt...)
+	return username + ":{SSHA}" + base64.StdEncoding.EncodeToString(hash), nil
+}
+
+func generatePassword() (string, error) {
+	data := make([]byte, passwordLength)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
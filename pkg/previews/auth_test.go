@@ -0,0 +1,82 @@
+package previews_test
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestProtectIngresses(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset(&networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api",
+			Namespace: ns,
+		},
+	})
+	getAnnotations := func() map[string]string {
+		ing, err := kubeClient.NetworkingV1().Ingresses(ns).Get(ctx, "api", metav1.GetOptions{})
+		require.NoError(t, err, "failed to get ingress")
+		return ing.Annotations
+	}
+
+	credentials, err := previews.ProtectIngresses(kubeClient, ns, &previewconfig.Auth{Mode: previewconfig.AuthModeBasic})
+	require.NoError(t, err, "failed to protect ingresses")
+	require.NotNil(t, credentials, "basic auth credentials")
+	assert.Equal(t, previewconfig.DefaultAuthUsername, credentials.Username, "username")
+	assert.NotEmpty(t, credentials.Password, "password")
+
+	annotations := getAnnotations()
+	assert.Equal(t, "basic", annotations[previews.AnnotationNginxAuthType], "auth type")
+	assert.Equal(t, previews.AuthSecretName, annotations[previews.AnnotationNginxAuthSecret], "auth secret")
+
+	secret, err := kubeClient.CoreV1().Secrets(ns).Get(ctx, previews.AuthSecretName, metav1.GetOptions{})
+	require.NoError(t, err, "failed to get auth secret")
+	assert.True(t, strings.HasPrefix(string(secret.Data["auth"]), "preview:{SSHA}"), "htpasswd %s", string(secret.Data["auth"]))
+
+	// the credentials are kept on later deploys
+	again, err := previews.ProtectIngresses(kubeClient, ns, &previewconfig.Auth{Mode: previewconfig.AuthModeBasic})
+	require.NoError(t, err, "failed to protect ingresses")
+	assert.Equal(t, credentials, again, "credentials should be reused")
+
+	// switching to external auth replaces the basic auth annotations
+	credentials, err = previews.ProtectIngresses(kubeClient, ns, &previewconfig.Auth{Mode: previewconfig.AuthModeExternal, URL: "https://oauth2.example.com/oauth2/auth"})
+	require.NoError(t, err, "failed to protect ingresses")
+	assert.Nil(t, credentials, "external auth credentials")
+	annotations = getAnnotations()
+	assert.Equal(t, "https://oauth2.example.com/oauth2/auth", annotations[previews.AnnotationNginxAuthURL], "auth url")
+	assert.Empty(t, annotations[previews.AnnotationNginxAuthType], "basic auth should be removed")
+
+	// disabling auth removes the protection
+	_, err = previews.ProtectIngresses(kubeClient, ns, nil)
+	require.NoError(t, err, "failed to remove protection")
+	assert.Empty(t, getAnnotations(), "annotations should be removed")
+	_, err = kubeClient.CoreV1().Secrets(ns).Get(ctx, previews.AuthSecretName, metav1.GetOptions{})
+	assert.Error(t, err, "auth secret should be removed")
+}
+
+func TestHTPasswd(t *testing.T) {
+	line, err := previews.HTPasswd("preview", "secret")
+	require.NoError(t, err, "failed to create htpasswd")
+
+	user, hashText, found := strings.Cut(line, ":{SSHA}")
+	require.True(t, found, "htpasswd %s", line)
+	assert.Equal(t, "preview", user)
+
+	data, err := base64.StdEncoding.DecodeString(hashText)
+	require.NoError(t, err, "failed to decode hash")
+	require.Len(t, data, sha1.Size+8, "hash and salt")
+	sum := sha1.Sum(append([]byte("secret"), data[sha1.Size:]...)) //nolint:gosec
+	assert.Equal(t, sum[:], data[:sha1.Size], "salted hash")
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
 	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"k8s.io/client-go/dynamic"
 )
 
 // LazyCreatePreviewClientAndNamespace lazy creates the preview client and/or the current namespace if not already defined
@@ -29,3 +30,20 @@ func LazyCreatePreviewClientAndNamespace(client versioned.Interface, ns string)
 	}
 	return client, ns, nil
 }
+
+// LazyCreateDynamicClient lazy creates the dynamic client if its not defined
+func LazyCreateDynamicClient(client dynamic.Interface) (dynamic.Interface, error) {
+	if client != nil {
+		return client, nil
+	}
+	f := kubeclient.NewFactory()
+	cfg, err := f.CreateKubeConfig()
+	if err != nil {
+		return client, fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+	client, err = dynamic.NewForConfig(cfg)
+	if err != nil {
+		return client, fmt.Errorf("error building dynamic client: %w", err)
+	}
+	return client, nil
+}
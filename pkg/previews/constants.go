@@ -0,0 +1,45 @@
+package previews
+
+const (
+	// AnnotationCopiedFrom the namespace and name of the resource a copy in a preview namespace was copied from
+	AnnotationCopiedFrom = "preview.jenkins.io/copied-from"
+
+	// AnnotationGCFailures the number of consecutive garbage collection runs which failed for a preview
+	AnnotationGCFailures = "preview.jenkins.io/gc-failures"
+
+	// AnnotationGCLastError the last error garbage collecting a preview
+	AnnotationGCLastError = "preview.jenkins.io/gc-last-error"
+
+	// AnnotationLockCommit the annotation on the Lease of a preview for the commit of the run holding the lock
+	AnnotationLockCommit = "preview.jenkins.io/lock-commit"
+
+	// AnnotationLockOrder the annotation on the Lease of a preview for the order of the run holding the lock
+	AnnotationLockOrder = "preview.jenkins.io/lock-order"
+
+	// AnnotationLockNextHolder the annotation on the Lease of a preview for the newest run waiting for the lock
+	AnnotationLockNextHolder = "preview.jenkins.io/lock-next-holder"
+
+	// AnnotationLockNextOrder the annotation on the Lease of a preview for the order of the newest run waiting for the lock
+	AnnotationLockNextOrder = "preview.jenkins.io/lock-next-order"
+
+	// AnnotationLockSource the annotation on the Lease of a preview for the pull request or branch of the run holding the lock
+	AnnotationLockSource = "preview.jenkins.io/lock-source"
+
+	// AnnotationLockNextSource the annotation on the Lease of a preview for the pull request or branch of the newest run waiting for the lock
+	AnnotationLockNextSource = "preview.jenkins.io/lock-next-source"
+
+	// AnnotationLastUpdated the time a preview was last deployed
+	AnnotationLastUpdated = "preview.jenkins.io/last-updated"
+
+	// LabelCopied the label on the resources copied into a preview namespace
+	LabelCopied = "preview.jenkins.io/copied"
+
+	// LabelGCFailing the label added to previews which keep failing to be garbage collected
+	LabelGCFailing = "preview.jenkins.io/gc-failing"
+
+	// LabelPreviewName the label on a preview namespace for the name of the Preview which owns it
+	LabelPreviewName = "preview.jenkins.io/name"
+
+	// LabelPreviewNamespace the label on a preview namespace for the namespace of the Preview which owns it
+	LabelPreviewNamespace = "preview.jenkins.io/namespace"
+)
@@ -0,0 +1,158 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// DefaultExternalSecretAPIVersion the default API version of ExternalSecrets
+const DefaultExternalSecretAPIVersion = "external-secrets.io/v1beta1"
+
+var (
+	// SecretsResource the resource of Secrets
+	SecretsResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	// ConfigMapsResource the resource of ConfigMaps
+	ConfigMapsResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+)
+
+// copyKind how to copy a kind of resource
+type copyKind struct {
+	kind   string
+	gvr    schema.GroupVersionResource
+	fields []string
+}
+
+// CopyResources copies the configured Secrets, ConfigMaps and ExternalSecrets into the preview namespace.
+// Copies are refreshed on every call and any previous copies which are no longer configured are removed
+func CopyResources(dynamicClient dynamic.Interface, ns, previewNamespace string, cfg *previewconfig.CopyResources) error {
+	if cfg == nil {
+		cfg = &previewconfig.CopyResources{}
+	}
+	err := copyResources(dynamicClient, copyKind{kind: "Secret", gvr: SecretsResource, fields: []string{"type", "data"}}, ns, previewNamespace, cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	err = copyResources(dynamicClient, copyKind{kind: "ConfigMap", gvr: ConfigMapsResource, fields: []string{"data", "binaryData"}}, ns, previewNamespace, cfg.ConfigMaps)
+	if err != nil {
+		return err
+	}
+
+	// lets group the ExternalSecrets by API version making sure we always clean up the default version
+	versions := map[string][]previewconfig.CopyResource{
+		DefaultExternalSecretAPIVersion: nil,
+	}
+	for _, r := range cfg.ExternalSecrets {
+		apiVersion := r.APIVersion
+		if apiVersion == "" {
+			apiVersion = DefaultExternalSecretAPIVersion
+		}
+		versions[apiVersion] = append(versions[apiVersion], r)
+	}
+	for apiVersion, resources := range versions {
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if err != nil {
+			return fmt.Errorf("invalid ExternalSecret API version %s: %w", apiVersion, err)
+		}
+		err = copyResources(dynamicClient, copyKind{kind: "ExternalSecret", gvr: gv.WithResource("externalsecrets"), fields: []string{"spec"}}, ns, previewNamespace, resources)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyResources(dynamicClient dynamic.Interface, k copyKind, ns, previewNamespace string, resources []previewconfig.CopyResource) error {
+	ctx := context.Background()
+	target := dynamicClient.Resource(k.gvr).Namespace(previewNamespace)
+	existingList, err := target.List(ctx, metav1.ListOptions{LabelSelector: LabelCopied + "=true"})
+	if err != nil {
+		if apierrors.IsNotFound(err) && len(resources) == 0 {
+			// the resource kind is not installed in the cluster
+			return nil
+		}
+		return fmt.Errorf("failed to list copied %ss in namespace %s: %w", k.kind, previewNamespace, err)
+	}
+	existing := map[string]*unstructured.Unstructured{}
+	for i := range existingList.Items {
+		existing[existingList.Items[i].GetName()] = &existingList.Items[i]
+	}
+
+	for _, r := range resources {
+		sourceNamespace := r.Namespace
+		if sourceNamespace == "" {
+			sourceNamespace = ns
+		}
+		src, err := dynamicClient.Resource(k.gvr).Namespace(sourceNamespace).Get(ctx, r.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s in namespace %s: %w", k.kind, r.Name, sourceNamespace, err)
+		}
+
+		name := r.GetTargetName()
+		copied := existing[name]
+		create := copied == nil
+		if create {
+			copied = &unstructured.Unstructured{Object: map[string]interface{}{}}
+			copied.SetAPIVersion(src.GetAPIVersion())
+			copied.SetKind(src.GetKind())
+			copied.SetName(name)
+			copied.SetNamespace(previewNamespace)
+		}
+		delete(existing, name)
+
+		labels := copied.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[LabelCopied] = "true"
+		copied.SetLabels(labels)
+		annotations := copied.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AnnotationCopiedFrom] = sourceNamespace + "/" + r.Name
+		copied.SetAnnotations(annotations)
+		for _, field := range k.fields {
+			value, found := src.Object[field]
+			if found {
+				copied.Object[field] = value
+			} else {
+				delete(copied.Object, field)
+			}
+		}
+
+		if create {
+			_, err = target.Create(ctx, copied, metav1.CreateOptions{})
+			if err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					return fmt.Errorf("cannot copy %s %s into namespace %s as it already exists and was not copied by jx-preview", k.kind, name, previewNamespace)
+				}
+				return fmt.Errorf("failed to create %s %s in namespace %s: %w", k.kind, name, previewNamespace, err)
+			}
+			log.Logger().Infof("copied %s %s from namespace %s into namespace %s", strings.ToLower(k.kind), info(r.Name), info(sourceNamespace), info(previewNamespace))
+			continue
+		}
+		_, err = target.Update(ctx, copied, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update %s %s in namespace %s: %w", k.kind, name, previewNamespace, err)
+		}
+	}
+
+	for name := range existing {
+		err = target.Delete(ctx, name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s %s in namespace %s: %w", k.kind, name, previewNamespace, err)
+		}
+		log.Logger().Infof("removed %s %s from namespace %s as it is no longer copied", strings.ToLower(k.kind), info(name), info(previewNamespace))
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestCopyResources(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	externalSecrets := schema.GroupVersionResource{Group: "external-secrets.io", Version: "v1beta1", Resource: "externalsecrets"}
+
+	newResource := func(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: fields}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetNamespace(namespace)
+		u.SetName(name)
+		return u
+	}
+
+	stale := newResource("v1", "Secret", previewNamespace, "stale", map[string]interface{}{})
+	stale.SetLabels(map[string]string{previews.LabelCopied: "true"})
+
+	dynamicClient := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			previews.SecretsResource:    "SecretList",
+			previews.ConfigMapsResource: "ConfigMapList",
+			externalSecrets:             "ExternalSecretList",
+		},
+		newResource("v1", "Secret", ns, "db-credentials", map[string]interface{}{
+			"type": "Opaque",
+			"data": map[string]interface{}{"password": "c2VjcmV0"},
+		}),
+		newResource("v1", "Secret", "other", "tls", map[string]interface{}{
+			"type": "kubernetes.io/tls",
+		}),
+		newResource("v1", "ConfigMap", ns, "settings", map[string]interface{}{
+			"data": map[string]interface{}{"mode": "preview"},
+		}),
+		newResource("external-secrets.io/v1beta1", "ExternalSecret", ns, "api-keys", map[string]interface{}{
+			"spec": map[string]interface{}{"refreshInterval": "1h"},
+		}),
+		stale,
+	)
+
+	cfg := &previewconfig.CopyResources{
+		Secrets: []previewconfig.CopyResource{
+			{Name: "db-credentials"},
+			{Name: "tls", Namespace: "other", TargetName: "preview-tls"},
+		},
+		ConfigMaps: []previewconfig.CopyResource{
+			{Name: "settings"},
+		},
+		ExternalSecrets: []previewconfig.CopyResource{
+			{Name: "api-keys"},
+		},
+	}
+
+	// lets copy twice to check the copies are updated
+	for i := 0; i < 2; i++ {
+		err := previews.CopyResources(dynamicClient, ns, previewNamespace, cfg)
+		require.NoError(t, err, "failed to copy resources")
+	}
+
+	ctx := context.Background()
+	secrets := dynamicClient.Resource(previews.SecretsResource).Namespace(previewNamespace)
+	secret, err := secrets.Get(ctx, "db-credentials", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get copied secret")
+	assert.Equal(t, "Opaque", secret.Object["type"], "secret type")
+	assert.Equal(t, map[string]interface{}{"password": "c2VjcmV0"}, secret.Object["data"], "secret data")
+	assert.Equal(t, "true", secret.GetLabels()[previews.LabelCopied], "copied label")
+	assert.Equal(t, "jx/db-credentials", secret.GetAnnotations()[previews.AnnotationCopiedFrom], "copied from annotation")
+
+	secret, err = secrets.Get(ctx, "preview-tls", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get renamed secret")
+	assert.Equal(t, "other/tls", secret.GetAnnotations()[previews.AnnotationCopiedFrom], "copied from annotation")
+
+	_, err = secrets.Get(ctx, "stale", metav1.GetOptions{})
+	assert.Error(t, err, "stale copy should have been removed")
+
+	cm, err := dynamicClient.Resource(previews.ConfigMapsResource).Namespace(previewNamespace).Get(ctx, "settings", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get copied configmap")
+	assert.Equal(t, map[string]interface{}{"mode": "preview"}, cm.Object["data"], "configmap data")
+
+	es, err := dynamicClient.Resource(externalSecrets).Namespace(previewNamespace).Get(ctx, "api-keys", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get copied external secret")
+	assert.Equal(t, map[string]interface{}{"refreshInterval": "1h"}, es.Object["spec"], "external secret spec")
+}
+
+func TestCopyResourcesRefusesToOverwrite(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+
+	src := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	src.SetAPIVersion("v1")
+	src.SetKind("Secret")
+	src.SetNamespace(ns)
+	src.SetName("db-credentials")
+
+	existing := src.DeepCopy()
+	existing.SetNamespace(previewNamespace)
+
+	dynamicClient := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			previews.SecretsResource:    "SecretList",
+			previews.ConfigMapsResource: "ConfigMapList",
+			{Group: "external-secrets.io", Version: "v1beta1", Resource: "externalsecrets"}: "ExternalSecretList",
+		},
+		src, existing,
+	)
+
+	cfg := &previewconfig.CopyResources{
+		Secrets: []previewconfig.CopyResource{{Name: "db-credentials"}},
+	}
+	err := previews.CopyResources(dynamicClient, ns, previewNamespace, cfg)
+	require.Error(t, err, "should not overwrite a secret which was not copied")
+	assert.Contains(t, err.Error(), "not copied by jx-preview")
+}
@@ -0,0 +1,109 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
+	jxc "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DependenciesHelmfileName the name of the helmfile generated in a temporary directory to deploy the dependencies
+const DependenciesHelmfileName = "helmfile-dependencies.yaml"
+
+// ResolveDependencies creates a helmfile which deploys the versions of the dependencies promoted to their environments
+// into the preview namespace using the jx-values.yaml file of the preview
+func ResolveDependencies(gitter gitclient.Interface, jxClient jxc.Interface, namespace, previewNamespace, jxValuesFile, gitUser, gitToken string, dependencies []helmfiles.Dependency) (*helmfiles.Helmfile, error) {
+	answer := &helmfiles.Helmfile{}
+	environments := map[string]*helmfiles.Helmfile{}
+	for _, dep := range dependencies {
+		envName := dep.EnvironmentName()
+		envHelmfile := environments[envName]
+		if envHelmfile == nil {
+			var err error
+			envHelmfile, err = loadEnvironmentHelmfile(gitter, jxClient, namespace, envName, gitUser, gitToken)
+			if err != nil {
+				return nil, err
+			}
+			environments[envName] = envHelmfile
+		}
+
+		release := envHelmfile.FindRelease(dep.Name)
+		if release == nil {
+			return nil, fmt.Errorf("could not find dependency %s in the %s environment", dep.Name, envName)
+		}
+		log.Logger().Infof("adding dependency %s version %s from the %s environment", info(release.Name), info(release.Version), info(envName))
+
+		// values files are relative to the environment repository so only inline values are kept
+		values := []interface{}{jxValuesFile}
+		for _, v := range release.Values {
+			if _, ok := v.(map[string]interface{}); ok {
+				values = append(values, v)
+			}
+		}
+		answer.Releases = append(answer.Releases, helmfiles.Release{
+			Name:      release.Name,
+			Chart:     release.Chart,
+			Version:   release.Version,
+			Namespace: previewNamespace,
+			Values:    values,
+		})
+
+		repoName, _, found := strings.Cut(release.Chart, "/")
+		if found && answer.FindRepository(repoName) == nil {
+			repo := envHelmfile.FindRepository(repoName)
+			if repo != nil {
+				answer.Repositories = append(answer.Repositories, *repo)
+			}
+		}
+	}
+	return answer, nil
+}
+
+// loadEnvironmentHelmfile loads the helmfile of the environment from its git repository. Environments in the same
+// cluster as the dev environment are stored in the dev environment repository
+func loadEnvironmentHelmfile(gitter gitclient.Interface, jxClient jxc.Interface, namespace, envName, gitUser, gitToken string) (*helmfiles.Helmfile, error) {
+	env, err := jxClient.JenkinsV1().Environments(namespace).Get(context.Background(), envName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the %s environment in namespace %s: %w", envName, namespace, err)
+	}
+	envNamespace := env.Spec.Namespace
+	if envNamespace == "" {
+		return nil, fmt.Errorf("environment %s does not have a namespace", envName)
+	}
+
+	url := env.Spec.Source.URL
+	if !env.Spec.RemoteCluster || url == "" {
+		devEnv, err := jxenv.GetDevEnvironment(jxClient, namespace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the dev environment in namespace %s: %w", namespace, err)
+		}
+		if devEnv == nil {
+			return nil, fmt.Errorf("cannot find the dev environment in namespace %s", namespace)
+		}
+		url = devEnv.Spec.Source.URL
+	}
+	if url == "" {
+		return nil, fmt.Errorf("environment %s does not have a source URL", envName)
+	}
+
+	gitCloneURL, err := CloneURLWithCredentials(url, gitUser, gitToken)
+	if err != nil {
+		return nil, err
+	}
+	helmfileDir := filepath.Join("helmfiles", envNamespace)
+	cloneDir, err := gitclient.SparseCloneToDir(gitter, gitCloneURL, "", true, helmfileDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone URL %s: %w", url, err)
+	}
+	defer os.RemoveAll(cloneDir)
+
+	return helmfiles.LoadHelmfile(filepath.Join(cloneDir, helmfileDir, "helmfile.yaml"))
+}
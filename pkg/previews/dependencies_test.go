@@ -0,0 +1,116 @@
+package previews_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/helmfiles"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner/fakerunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/cli"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	stagingHelmfile = `repositories:
+- name: bitnami
+  url: https://charts.bitnami.com/bitnami
+releases:
+- name: db
+  chart: bitnami/postgresql
+  version: 1.2.3
+  values:
+  - ../../values/db.yaml
+  - auth:
+      database: app
+`
+	productionHelmfile = `releases:
+- name: cache
+  chart: oci://registry.example.com/charts/redis
+  version: 4.5.6
+`
+)
+
+func TestResolveDependencies(t *testing.T) {
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	gitter, jxClient := newDependencyClients()
+
+	helmfile, err := previews.ResolveDependencies(gitter, jxClient, "jx", previewNamespace, "/workspace/preview/jx-values.yaml", "myuser", "mytoken", []helmfiles.Dependency{{Name: "db"}})
+	require.NoError(t, err, "failed to resolve dependencies")
+	require.Len(t, helmfile.Releases, 1, "releases")
+	release := helmfile.Releases[0]
+	assert.Equal(t, "bitnami/postgresql", release.Chart, "chart")
+	assert.Equal(t, "1.2.3", release.Version, "version of the staging environment")
+	assert.Equal(t, previewNamespace, release.Namespace, "namespace")
+	assert.Equal(t, []interface{}{"/workspace/preview/jx-values.yaml", map[string]interface{}{"auth": map[string]interface{}{"database": "app"}}}, release.Values, "only inline values should be kept")
+	assert.Equal(t, []helmfiles.Repository{{Name: "bitnami", URL: "https://charts.bitnami.com/bitnami"}}, helmfile.Repositories, "repositories")
+}
+
+func TestResolveDependenciesMissing(t *testing.T) {
+	gitter, jxClient := newDependencyClients()
+
+	_, err := previews.ResolveDependencies(gitter, jxClient, "jx", "jx-myowner-myrepo-pr-1", "jx-values.yaml", "myuser", "mytoken", []helmfiles.Dependency{{Name: "db"}, {Name: "search"}})
+	require.Error(t, err, "should fail for a missing dependency")
+	assert.Contains(t, err.Error(), "could not find dependency search in the staging environment", "error")
+}
+
+func TestResolveDependenciesRemoteEnvironment(t *testing.T) {
+	gitter, jxClient := newDependencyClients()
+
+	helmfile, err := previews.ResolveDependencies(gitter, jxClient, "jx", "jx-myowner-myrepo-pr-1", "jx-values.yaml", "myuser", "mytoken", []helmfiles.Dependency{{Name: "cache", Environment: "production"}})
+	require.NoError(t, err, "failed to resolve dependencies")
+	require.Len(t, helmfile.Releases, 1, "releases")
+	assert.Equal(t, "cache", helmfile.Releases[0].Name, "release")
+	assert.Equal(t, "4.5.6", helmfile.Releases[0].Version, "version of the production environment")
+	assert.Empty(t, helmfile.Repositories, "repositories")
+}
+
+// newDependencyClients creates the staging environment stored in the dev environment repository and
+// the production environment in its own repository
+func newDependencyClients() (gitclient.Interface, *jxfake.Clientset) {
+	ns := "jx"
+	devEnv := jxenv.CreateDefaultDevEnvironment(ns)
+	devEnv.Namespace = ns
+	devEnv.Spec.Source.URL = "https://github.com/myorg/environment-dev.git"
+	staging := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "staging", Namespace: ns},
+		Spec:       v1.EnvironmentSpec{Namespace: "jx-staging"},
+	}
+	production := &v1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "production", Namespace: ns},
+		Spec: v1.EnvironmentSpec{
+			Namespace:     "jx-production",
+			RemoteCluster: true,
+			Source:        v1.EnvironmentRepository{URL: "https://github.com/myorg/environment-production.git"},
+		},
+	}
+
+	runner := &fakerunner.FakeRunner{
+		CommandRunner: func(c *cmdrunner.Command) (string, error) {
+			if c.Name != "git" || c.Args[0] != "clone" {
+				return "", nil
+			}
+			url, dir := c.Args[len(c.Args)-2], c.Args[len(c.Args)-1]
+			envNamespace, content := "jx-staging", stagingHelmfile
+			if strings.Contains(url, "environment-production") {
+				envNamespace, content = "jx-production", productionHelmfile
+			}
+			helmfileDir := filepath.Join(dir, "helmfiles", envNamespace)
+			err := os.MkdirAll(helmfileDir, 0755)
+			if err != nil {
+				return "", err
+			}
+			return "", os.WriteFile(filepath.Join(helmfileDir, "helmfile.yaml"), []byte(content), 0600)
+		},
+	}
+	return cli.NewCLIClient("", runner.Run), jxfake.NewSimpleClientset(devEnv, staging, production)
+}
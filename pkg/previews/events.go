@@ -0,0 +1,120 @@
+package previews
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/scheme"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// EventComponent the source component of the Events recorded on Previews
+	EventComponent = "jx-preview"
+
+	// ReasonDeploying a preview is being deployed
+	ReasonDeploying = "Deploying"
+
+	// ReasonDeployed a preview was deployed
+	ReasonDeployed = "Deployed"
+
+	// ReasonDeployFailed a preview failed to deploy
+	ReasonDeployFailed = "DeployFailed"
+
+	// ReasonRolledBack a preview was rolled back to a previous deploy
+	ReasonRolledBack = "RolledBack"
+
+	// ReasonDestroying a preview is being destroyed
+	ReasonDestroying = "Destroying"
+
+	// ReasonDestroyFailed the resources of a preview could not be destroyed
+	ReasonDestroyFailed = "DestroyFailed"
+
+	// ReasonDestroyed a preview was destroyed
+	ReasonDestroyed = "Destroyed"
+
+	// ReasonGarbageCollecting a preview is no longer needed and is being garbage collected
+	ReasonGarbageCollecting = "GarbageCollecting"
+
+	// ReasonGarbageCollectionFailed a preview could not be garbage collected
+	ReasonGarbageCollectionFailed = "GarbageCollectionFailed"
+
+	// ReasonEvicted a preview was evicted as it exceeds the preview quotas
+	ReasonEvicted = "Evicted"
+
+	// eventFlushTimeout the maximum time to wait for the recorded Events to be written
+	eventFlushTimeout = 10 * time.Second
+)
+
+// EventRecorder records Events on Previews
+type EventRecorder interface {
+	record.EventRecorder
+
+	// Flush waits for the recorded Events to be written before the command exits
+	Flush()
+}
+
+type eventRecorder struct {
+	recorder    record.EventRecorder
+	broadcaster record.EventBroadcaster
+	pending     sync.WaitGroup
+}
+
+// NewEventRecorder creates a recorder of Events on Previews using the Preview clientset scheme
+func NewEventRecorder(kubeClient kubernetes.Interface) EventRecorder {
+	r := &eventRecorder{
+		broadcaster: record.NewBroadcaster(),
+	}
+	sink := &typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")}
+	r.broadcaster.StartEventWatcher(func(event *corev1.Event) {
+		defer r.pending.Done()
+		_, err := sink.Create(event)
+		if err != nil {
+			log.Logger().Debugf("failed to record event %s on %s %s: %s", event.Reason, event.InvolvedObject.Kind, event.InvolvedObject.Name, err.Error())
+		}
+	})
+	r.recorder = r.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: EventComponent})
+	return r
+}
+
+// LazyCreateEventRecorder lazy creates the event recorder if its not defined
+func LazyCreateEventRecorder(recorder EventRecorder, kubeClient kubernetes.Interface) EventRecorder {
+	if recorder != nil {
+		return recorder
+	}
+	return NewEventRecorder(kubeClient)
+}
+
+func (r *eventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.pending.Add(1)
+	r.recorder.Event(object, eventtype, reason, message)
+}
+
+func (r *eventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.pending.Add(1)
+	r.recorder.Eventf(object, eventtype, reason, messageFmt, args...)
+}
+
+func (r *eventRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.pending.Add(1)
+	r.recorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+}
+
+func (r *eventRecorder) Flush() {
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(eventFlushTimeout):
+		log.Logger().Warnf("timed out waiting for the preview events to be recorded")
+	}
+	r.broadcaster.Shutdown()
+}
@@ -0,0 +1,48 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestEventRecorder(t *testing.T) {
+	ns := "jx"
+	kubeClient := fakekube.NewSimpleClientset()
+	preview := &v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jx-myowner-myrepo-pr-1",
+			Namespace: ns,
+			UID:       "1234",
+		},
+	}
+
+	recorder := previews.NewEventRecorder(kubeClient)
+	recorder.Eventf(preview, corev1.EventTypeNormal, previews.ReasonDeploying, "deploying commit %s", "1a2b3c4")
+	recorder.Event(preview, corev1.EventTypeWarning, previews.ReasonDeployFailed, "failed to run helmfile sync")
+	recorder.Flush()
+
+	events, err := kubeClient.CoreV1().Events(ns).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err, "failed to list events")
+	require.Len(t, events.Items, 2, "events")
+
+	reasons := map[string]string{}
+	for i := range events.Items {
+		event := &events.Items[i]
+		assert.Equal(t, "Preview", event.InvolvedObject.Kind, "involved object kind")
+		assert.Equal(t, preview.Name, event.InvolvedObject.Name, "involved object name")
+		assert.Equal(t, previews.EventComponent, event.Source.Component, "source component")
+		reasons[event.Reason] = event.Type
+	}
+	assert.Equal(t, map[string]string{
+		previews.ReasonDeploying:    corev1.EventTypeNormal,
+		previews.ReasonDeployFailed: corev1.EventTypeWarning,
+	}, reasons)
+}
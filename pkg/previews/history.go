@@ -0,0 +1,85 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// MaxHistory the maximum number of deploys kept in the history of a preview
+const MaxHistory = 10
+
+// AddDeploy adds the deploy to the history of the preview removing the oldest deploys so at most MaxHistory are kept.
+// The preview is marked as degraded if the deploy failed and was rolled back
+func AddDeploy(preview *v1alpha1.Preview, deploy *v1alpha1.PreviewDeploy) {
+	preview.Status.History = append(preview.Status.History, *deploy)
+	if len(preview.Status.History) > MaxHistory {
+		preview.Status.History = preview.Status.History[len(preview.Status.History)-MaxHistory:]
+	}
+
+	switch {
+	case deploy.Outcome == v1alpha1.DeployOutcomeSucceeded:
+		preview.Status.Degraded = false
+		preview.Status.ServingCommit = deploy.Commit
+	case deploy.RolledBackTo != "":
+		preview.Status.Degraded = true
+		preview.Status.ServingCommit = deploy.RolledBackTo
+	default:
+		// a failed deploy leaves the preview partially upgraded
+		preview.Status.Degraded = false
+		preview.Status.ServingCommit = ""
+	}
+}
+
+// RecordDeploy adds the deploy to the history of the Preview applying its status as a separate patch.
+// It retries if the Preview is modified concurrently
+func RecordDeploy(client versioned.Interface, ns, name string, deploy *v1alpha1.PreviewDeploy) (*v1alpha1.Preview, error) {
+	ctx := context.Background()
+	previewInterface := client.PreviewV1alpha1().Previews(ns)
+	var answer *v1alpha1.Preview
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		preview, err := previewInterface.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		AddDeploy(preview, deploy)
+		answer, err = ApplyStatus(client, preview)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record the deploy of preview %s in namespace %s: %w", name, ns, err)
+	}
+	return answer, nil
+}
+
+// LastDeploy returns the most recent deploy of the preview or nil if it has never been deployed
+func LastDeploy(preview *v1alpha1.Preview) *v1alpha1.PreviewDeploy {
+	history := preview.Status.History
+	if len(history) == 0 {
+		return nil
+	}
+	return &history[len(history)-1]
+}
+
+// LastSuccessfulDeploy returns the most recent successful deploy of the preview or nil if it has never been deployed successfully
+func LastSuccessfulDeploy(preview *v1alpha1.Preview) *v1alpha1.PreviewDeploy {
+	history := preview.Status.History
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Outcome == v1alpha1.DeployOutcomeSucceeded {
+			return &history[i]
+		}
+	}
+	return nil
+}
+
+// ShortCommit returns the abbreviated commit
+func ShortCommit(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,55 @@
+package previews_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddDeploy(t *testing.T) {
+	preview := &v1alpha1.Preview{}
+	assert.Nil(t, previews.LastDeploy(preview), "no deploys yet")
+
+	for i := 1; i <= previews.MaxHistory+2; i++ {
+		previews.AddDeploy(preview, &v1alpha1.PreviewDeploy{
+			BuildNumber: fmt.Sprintf("%d", i),
+			Outcome:     v1alpha1.DeployOutcomeSucceeded,
+		})
+	}
+	require.Len(t, preview.Status.History, previews.MaxHistory, "history should be trimmed")
+	assert.Equal(t, "3", preview.Status.History[0].BuildNumber, "oldest deploy kept")
+
+	last := previews.LastDeploy(preview)
+	require.NotNil(t, last, "last deploy")
+	assert.Equal(t, fmt.Sprintf("%d", previews.MaxHistory+2), last.BuildNumber, "last deploy")
+
+	assert.Equal(t, "1a2b3c4", previews.ShortCommit("1a2b3c4d5e6f"))
+	assert.Equal(t, "1a2b", previews.ShortCommit("1a2b"))
+}
+
+func TestAddDeployRolledBack(t *testing.T) {
+	preview := &v1alpha1.Preview{}
+	previews.AddDeploy(preview, &v1alpha1.PreviewDeploy{Commit: "c1", Outcome: v1alpha1.DeployOutcomeSucceeded})
+	assert.False(t, preview.Status.Degraded, "degraded after a successful deploy")
+	assert.Equal(t, "c1", preview.Status.ServingCommit, "serving commit")
+
+	previews.AddDeploy(preview, &v1alpha1.PreviewDeploy{Commit: "c2", Outcome: v1alpha1.DeployOutcomeFailed, RolledBackTo: "c1"})
+	assert.True(t, preview.Status.Degraded, "degraded after a rolled back deploy")
+	assert.Equal(t, "c1", preview.Status.ServingCommit, "serving commit after rollback")
+
+	last := previews.LastSuccessfulDeploy(preview)
+	require.NotNil(t, last, "last successful deploy")
+	assert.Equal(t, "c1", last.Commit, "last successful commit")
+
+	previews.AddDeploy(preview, &v1alpha1.PreviewDeploy{Commit: "c3", Outcome: v1alpha1.DeployOutcomeFailed})
+	assert.False(t, preview.Status.Degraded, "degraded after a failed deploy without a rollback")
+	assert.Empty(t, preview.Status.ServingCommit, "serving commit after a failed deploy")
+
+	previews.AddDeploy(preview, &v1alpha1.PreviewDeploy{Commit: "c4", Outcome: v1alpha1.DeployOutcomeSucceeded})
+	assert.Equal(t, "c4", previews.LastSuccessfulDeploy(preview).Commit, "last successful commit")
+	assert.Equal(t, "c4", preview.Status.ServingCommit, "serving commit")
+}
@@ -44,43 +44,9 @@ func CreateJXValuesFileWithCloneDir(gitter gitclient.Interface, jxClient jxc.Int
 		if url == "" {
 			return "", fmt.Errorf("environment %s does not have a source URL", devEnv.Name)
 		}
-		if gitUser == "" || gitToken == "" {
-			creds, err := loadcreds.LoadGitCredential()
-			if err != nil {
-				return "", fmt.Errorf("failed to load git credentials: %w", err)
-			}
-
-			gitInfo, err := giturl.ParseGitURL(url)
-			if err != nil {
-				return "", fmt.Errorf("failed to parse git URL %s: %w", url, err)
-			}
-			gitServerURL := gitInfo.HostURL()
-			serverCreds := loadcreds.GetServerCredentials(creds, gitServerURL)
-
-			if gitUser == "" {
-				gitUser = serverCreds.Username
-			}
-			if gitToken == "" {
-				gitToken = serverCreds.Password
-			}
-			if gitToken == "" {
-				gitToken = serverCreds.Token
-			}
-
-			if gitUser == "" {
-				return "", fmt.Errorf("could not find git user for git server %s", gitServerURL)
-			}
-			if gitToken == "" {
-				return "", fmt.Errorf("could not find git token for git server %s", gitServerURL)
-			}
-		}
-
-		gitCloneURL := url
-		if gitUser != "" && gitToken != "" {
-			gitCloneURL, err = stringhelpers.URLSetUserPassword(url, gitUser, gitToken)
-			if err != nil {
-				return "", fmt.Errorf("failed to add user and token to git url %s: %w", url, err)
-			}
+		gitCloneURL, err := CloneURLWithCredentials(url, gitUser, gitToken)
+		if err != nil {
+			return "", err
 		}
 
 		cloneDir, err = gitclient.SparseCloneToDir(gitter, gitCloneURL, "", true, jxValuesDir)
@@ -114,3 +80,43 @@ func CreateJXValuesFileWithCloneDir(gitter gitclient.Interface, jxClient jxc.Int
 	}
 	return cloneDir, nil
 }
+
+// CloneURLWithCredentials adds the git user and token to the URL, loading them from the git credentials if not specified
+func CloneURLWithCredentials(url, gitUser, gitToken string) (string, error) {
+	if gitUser == "" || gitToken == "" {
+		creds, err := loadcreds.LoadGitCredential()
+		if err != nil {
+			return "", fmt.Errorf("failed to load git credentials: %w", err)
+		}
+
+		gitInfo, err := giturl.ParseGitURL(url)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse git URL %s: %w", url, err)
+		}
+		gitServerURL := gitInfo.HostURL()
+		serverCreds := loadcreds.GetServerCredentials(creds, gitServerURL)
+
+		if gitUser == "" {
+			gitUser = serverCreds.Username
+		}
+		if gitToken == "" {
+			gitToken = serverCreds.Password
+		}
+		if gitToken == "" {
+			gitToken = serverCreds.Token
+		}
+
+		if gitUser == "" {
+			return "", fmt.Errorf("could not find git user for git server %s", gitServerURL)
+		}
+		if gitToken == "" {
+			return "", fmt.Errorf("could not find git token for git server %s", gitServerURL)
+		}
+	}
+
+	gitCloneURL, err := stringhelpers.URLSetUserPassword(url, gitUser, gitToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to add user and token to git url %s: %w", url, err)
+	}
+	return gitCloneURL, nil
+}
@@ -0,0 +1,97 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceLimitsName the name of the ResourceQuota and LimitRange created in preview namespaces
+const ResourceLimitsName = "jx-preview"
+
+// ApplyResourceLimits creates or updates the ResourceQuota and LimitRange in the preview namespace.
+// Existing resources are only updated if their spec has changed. If either spec is nil or empty any existing resource is removed
+func ApplyResourceLimits(kubeClient kubernetes.Interface, previewNamespace string, quota *corev1.ResourceQuotaSpec, limits *corev1.LimitRangeSpec) error {
+	ctx := context.Background()
+
+	quotaInterface := kubeClient.CoreV1().ResourceQuotas(previewNamespace)
+	existingQuota, err := quotaInterface.Get(ctx, ResourceLimitsName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get ResourceQuota %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		existingQuota = nil
+	}
+	switch {
+	case quota == nil || len(quota.Hard) == 0:
+		if existingQuota != nil {
+			err = quotaInterface.Delete(ctx, ResourceLimitsName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete ResourceQuota %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+			}
+		}
+	case existingQuota == nil:
+		_, err = quotaInterface.Create(ctx, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ResourceLimitsName,
+				Namespace: previewNamespace,
+			},
+			Spec: *quota,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create ResourceQuota %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		log.Logger().Infof("created ResourceQuota %s in namespace %s", info(ResourceLimitsName), info(previewNamespace))
+	case !equality.Semantic.DeepEqual(existingQuota.Spec, *quota):
+		existingQuota.Spec = *quota
+		_, err = quotaInterface.Update(ctx, existingQuota, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update ResourceQuota %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		log.Logger().Infof("updated ResourceQuota %s in namespace %s", info(ResourceLimitsName), info(previewNamespace))
+	}
+
+	limitRangeInterface := kubeClient.CoreV1().LimitRanges(previewNamespace)
+	existingLimits, err := limitRangeInterface.Get(ctx, ResourceLimitsName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get LimitRange %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		existingLimits = nil
+	}
+	switch {
+	case limits == nil || len(limits.Limits) == 0:
+		if existingLimits != nil {
+			err = limitRangeInterface.Delete(ctx, ResourceLimitsName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete LimitRange %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+			}
+		}
+	case existingLimits == nil:
+		_, err = limitRangeInterface.Create(ctx, &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      ResourceLimitsName,
+				Namespace: previewNamespace,
+			},
+			Spec: *limits,
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create LimitRange %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		log.Logger().Infof("created LimitRange %s in namespace %s", info(ResourceLimitsName), info(previewNamespace))
+	case !equality.Semantic.DeepEqual(existingLimits.Spec, *limits):
+		existingLimits.Spec = *limits
+		_, err = limitRangeInterface.Update(ctx, existingLimits, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update LimitRange %s in namespace %s: %w", ResourceLimitsName, previewNamespace, err)
+		}
+		log.Logger().Infof("updated LimitRange %s in namespace %s", info(ResourceLimitsName), info(previewNamespace))
+	}
+	return nil
+}
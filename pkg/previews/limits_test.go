@@ -0,0 +1,93 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestApplyResourceLimits(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset()
+	quota := &corev1.ResourceQuotaSpec{
+		Hard: corev1.ResourceList{
+			corev1.ResourcePods: resource.MustParse("10"),
+		},
+	}
+	limits := &corev1.LimitRangeSpec{
+		Limits: []corev1.LimitRangeItem{
+			{
+				Type: corev1.LimitTypeContainer,
+				Default: corev1.ResourceList{
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+			},
+		},
+	}
+
+	err := previews.ApplyResourceLimits(kubeClient, ns, quota, limits)
+	require.NoError(t, err, "failed to create resource limits")
+	createdQuota, err := kubeClient.CoreV1().ResourceQuotas(ns).Get(ctx, previews.ResourceLimitsName, metav1.GetOptions{})
+	require.NoError(t, err, "failed to get ResourceQuota")
+	assert.Equal(t, *quota, createdQuota.Spec, "ResourceQuota spec")
+	createdLimits, err := kubeClient.CoreV1().LimitRanges(ns).Get(ctx, previews.ResourceLimitsName, metav1.GetOptions{})
+	require.NoError(t, err, "failed to get LimitRange")
+	assert.Equal(t, *limits, createdLimits.Spec, "LimitRange spec")
+
+	// unchanged specs are not updated
+	kubeClient.ClearActions()
+	err = previews.ApplyResourceLimits(kubeClient, ns, quota, limits)
+	require.NoError(t, err, "failed to apply unchanged resource limits")
+	for _, action := range kubeClient.Actions() {
+		assert.Equal(t, "get", action.GetVerb(), "unexpected %s of %s", action.GetVerb(), action.GetResource().Resource)
+	}
+
+	// changed specs are updated
+	quota.Hard[corev1.ResourcePods] = resource.MustParse("20")
+	kubeClient.ClearActions()
+	err = previews.ApplyResourceLimits(kubeClient, ns, quota, limits)
+	require.NoError(t, err, "failed to update resource limits")
+	updatedQuota, err := kubeClient.CoreV1().ResourceQuotas(ns).Get(ctx, previews.ResourceLimitsName, metav1.GetOptions{})
+	require.NoError(t, err, "failed to get ResourceQuota")
+	assert.Equal(t, resource.MustParse("20"), updatedQuota.Spec.Hard[corev1.ResourcePods], "updated pods quota")
+	var updated []string
+	for _, action := range kubeClient.Actions() {
+		if update, ok := action.(clienttesting.UpdateAction); ok {
+			updated = append(updated, update.GetResource().Resource)
+		}
+	}
+	assert.Equal(t, []string{"resourcequotas"}, updated, "only the changed ResourceQuota should be updated")
+}
+
+func TestApplyResourceLimitsDisabled(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset(
+		&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: previews.ResourceLimitsName, Namespace: ns}},
+		&corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: previews.ResourceLimitsName, Namespace: ns}},
+	)
+
+	err := previews.ApplyResourceLimits(kubeClient, ns, &corev1.ResourceQuotaSpec{}, nil)
+	require.NoError(t, err, "failed to remove resource limits")
+	_, err = kubeClient.CoreV1().ResourceQuotas(ns).Get(ctx, previews.ResourceLimitsName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "ResourceQuota should be removed")
+	_, err = kubeClient.CoreV1().LimitRanges(ns).Get(ctx, previews.ResourceLimitsName, metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "LimitRange should be removed")
+
+	// nothing is created when disabled
+	err = previews.ApplyResourceLimits(kubeClient, ns, nil, nil)
+	require.NoError(t, err, "failed to apply disabled resource limits")
+	quotas, err := kubeClient.CoreV1().ResourceQuotas(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err, "failed to list ResourceQuotas")
+	assert.Empty(t, quotas.Items, "ResourceQuotas")
+}
@@ -0,0 +1,166 @@
+package previews
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+)
+
+// LinkDirective the directive in a pull request description which links another pull request into the same preview
+const LinkDirective = "/preview-with"
+
+// pullRequestPathSegments the URL path segments which precede the pull request number on the different git providers
+var pullRequestPathSegments = map[string]bool{
+	"pull":           true,
+	"pulls":          true,
+	"merge_requests": true,
+	"pull-requests":  true,
+}
+
+// ParseLinkDirectives returns the pull requests linked via /preview-with directives in the pull request description
+func ParseLinkDirectives(body string) ([]v1alpha1.PullRequest, error) {
+	var answer []v1alpha1.PullRequest
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != LinkDirective {
+			continue
+		}
+		for _, text := range fields[1:] {
+			pr, err := ParsePullRequestRef(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s directive: %w", LinkDirective, err)
+			}
+			answer = append(answer, *pr)
+		}
+	}
+	return answer, nil
+}
+
+// ParsePullRequestRef parses a pull request reference of the form owner/repo#123 or a pull request URL
+func ParsePullRequestRef(text string) (*v1alpha1.PullRequest, error) {
+	if strings.Contains(text, "://") {
+		u, err := url.Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pull request URL %s: %w", text, err)
+		}
+		paths := strings.Split(strings.Trim(u.Path, "/"), "/")
+		for i := 2; i+1 < len(paths); i++ {
+			if !pullRequestPathSegments[paths[i]] {
+				continue
+			}
+			number, err := strconv.Atoi(paths[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid pull request number in URL %s: %w", text, err)
+			}
+			// gitlab URLs separate the repository from the merge request with a dash
+			end := i
+			if paths[end-1] == "-" {
+				end--
+			}
+			if end < 2 {
+				break
+			}
+			return &v1alpha1.PullRequest{
+				Number:     number,
+				Owner:      strings.Join(paths[:end-1], "/"),
+				Repository: paths[end-1],
+				URL:        text,
+			}, nil
+		}
+		return nil, fmt.Errorf("could not find the pull request number in URL %s", text)
+	}
+
+	repoName, numberText, ok := strings.Cut(text, "#")
+	if !ok {
+		return nil, fmt.Errorf("pull request %s should be of the form owner/repository#number", text)
+	}
+	idx := strings.LastIndex(repoName, "/")
+	if idx <= 0 || idx == len(repoName)-1 {
+		return nil, fmt.Errorf("pull request %s should be of the form owner/repository#number", text)
+	}
+	number, err := strconv.Atoi(numberText)
+	if err != nil || number <= 0 {
+		return nil, fmt.Errorf("invalid pull request number in %s", text)
+	}
+	return &v1alpha1.PullRequest{
+		Number:     number,
+		Owner:      repoName[:idx],
+		Repository: repoName[idx+1:],
+	}, nil
+}
+
+// IsSamePullRequest returns true if both refer to the same pull request
+func IsSamePullRequest(a, b *v1alpha1.PullRequest) bool {
+	return a.Number == b.Number && strings.EqualFold(a.Owner, b.Owner) && strings.EqualFold(a.Repository, b.Repository)
+}
+
+// FindLinkedPreview returns the Preview of a pull request which is linked to the given pull request, either because
+// the given pull request links to it or because it links to the given pull request. Returns nil if there is none
+func FindLinkedPreview(resources []v1alpha1.Preview, pr *v1alpha1.PullRequest, links []v1alpha1.PullRequest) *v1alpha1.Preview {
+	for i := range resources {
+		preview := &resources[i]
+		if preview.Spec.Branch != nil {
+			continue
+		}
+		for j := range links {
+			if IsSamePullRequest(&preview.Spec.PullRequest, &links[j]) {
+				return preview
+			}
+		}
+		for j := range preview.Spec.LinkedPullRequests {
+			if IsSamePullRequest(&preview.Spec.LinkedPullRequests[j], pr) {
+				return preview
+			}
+		}
+	}
+	return nil
+}
+
+// AddLinkedPullRequests adds or updates the linked pull requests of the preview returning true if it was modified
+func AddLinkedPullRequests(preview *v1alpha1.Preview, links ...v1alpha1.PullRequest) bool {
+	modified := false
+	for i := range links {
+		link := &links[i]
+		if IsSamePullRequest(&preview.Spec.PullRequest, link) {
+			continue
+		}
+		found := false
+		for j := range preview.Spec.LinkedPullRequests {
+			existing := &preview.Spec.LinkedPullRequests[j]
+			if !IsSamePullRequest(existing, link) {
+				continue
+			}
+			found = true
+			updated := mergePullRequest(existing, link)
+			modified = modified || updated
+		}
+		if !found {
+			preview.Spec.LinkedPullRequests = append(preview.Spec.LinkedPullRequests, *link)
+			modified = true
+		}
+	}
+	return modified
+}
+
+// mergePullRequest copies any populated fields into the existing pull request
+func mergePullRequest(existing, pr *v1alpha1.PullRequest) bool {
+	before := *existing
+	if pr.URL != "" {
+		existing.URL = pr.URL
+	}
+	if pr.Title != "" {
+		existing.Title = pr.Title
+	}
+	if pr.LatestCommit != "" {
+		existing.LatestCommit = pr.LatestCommit
+	}
+	if pr.User.Username != "" {
+		existing.User = pr.User
+	}
+	return before != *existing
+}
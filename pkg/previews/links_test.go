@@ -0,0 +1,76 @@
+package previews_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePullRequestRef(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected *v1alpha1.PullRequest
+	}{
+		{
+			text:     "myorg/backend#12",
+			expected: &v1alpha1.PullRequest{Owner: "myorg", Repository: "backend", Number: 12},
+		},
+		{
+			text:     "https://github.com/myorg/backend/pull/12",
+			expected: &v1alpha1.PullRequest{Owner: "myorg", Repository: "backend", Number: 12, URL: "https://github.com/myorg/backend/pull/12"},
+		},
+		{
+			text:     "https://gitlab.com/mygroup/sub/backend/-/merge_requests/7",
+			expected: &v1alpha1.PullRequest{Owner: "mygroup/sub", Repository: "backend", Number: 7, URL: "https://gitlab.com/mygroup/sub/backend/-/merge_requests/7"},
+		},
+		{
+			text: "backend#12",
+		},
+		{
+			text: "myorg/backend#abc",
+		},
+		{
+			text: "https://github.com/myorg/backend",
+		},
+	}
+
+	for _, tc := range testCases {
+		pr, err := previews.ParsePullRequestRef(tc.text)
+		if tc.expected == nil {
+			assert.Error(t, err, "for %s", tc.text)
+			continue
+		}
+		require.NoError(t, err, "for %s", tc.text)
+		assert.Equal(t, tc.expected, pr, "for %s", tc.text)
+	}
+}
+
+func TestLinkedPreviews(t *testing.T) {
+	body := `Adds the cheese API
+
+/preview-with myorg/backend#12
+/preview-without myorg/other#3
+`
+	links, err := previews.ParseLinkDirectives(body)
+	require.NoError(t, err, "failed to parse directives")
+	require.Len(t, links, 1, "links")
+
+	frontend := &v1alpha1.PullRequest{Owner: "myorg", Repository: "frontend", Number: 5}
+	backend := v1alpha1.Preview{}
+	backend.Name = "backend"
+	backend.Spec.PullRequest = v1alpha1.PullRequest{Owner: "MyOrg", Repository: "backend", Number: 12}
+
+	resources := []v1alpha1.Preview{backend}
+	found := previews.FindLinkedPreview(resources, frontend, links)
+	require.NotNil(t, found, "should find the preview the pull request links to")
+	assert.Equal(t, "backend", found.Name)
+
+	assert.True(t, previews.AddLinkedPullRequests(found, *frontend), "should add the linked pull request")
+	assert.False(t, previews.AddLinkedPullRequests(found, *frontend), "should not add the same pull request twice")
+
+	// the reverse link is found from the preview
+	assert.Equal(t, found, previews.FindLinkedPreview([]v1alpha1.Preview{*found}, frontend, nil), "should find the preview linking to the pull request")
+}
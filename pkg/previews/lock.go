@@ -0,0 +1,376 @@
+package previews
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// DefaultLockTimeout the default time to wait for the lock of a preview
+	DefaultLockTimeout = 30 * time.Minute
+
+	// DefaultLeaseDuration the default time after which the lock of a preview expires if it is not renewed
+	DefaultLeaseDuration = time.Minute
+
+	// DefaultLockPollInterval the default time between attempts to take the lock of a preview
+	DefaultLockPollInterval = 5 * time.Second
+)
+
+var (
+	// ErrSuperseded the run waiting for the lock of a preview is superseded by a run of a newer commit
+	ErrSuperseded = errors.New("superseded by a newer commit")
+
+	// ErrLockLost the lock of a preview could not be renewed and may be held by another run
+	ErrLockLost = errors.New("lost the lock")
+)
+
+// LockOwner the run of create or destroy taking the lock of a preview
+type LockOwner struct {
+	// Holder the unique identity of the run
+	Holder string
+
+	// Commit the commit being deployed
+	Commit string
+
+	// Source the pull request or branch of the run. Only runs of the same source supersede each other
+	Source string
+
+	// Order orders the runs so that waiting runs of older commits are superseded by newer ones
+	Order int64
+}
+
+// LockOptions the options for taking the lock of a preview
+type LockOptions struct {
+	Timeout       time.Duration
+	LeaseDuration time.Duration
+	PollInterval  time.Duration
+}
+
+// Lock the Lease based lock of a preview which is renewed until it is released
+type Lock struct {
+	kubeClient    kubernetes.Interface
+	ns            string
+	name          string
+	owner         LockOwner
+	leaseDuration time.Duration
+	stop          chan struct{}
+	done          chan struct{}
+	lost          chan struct{}
+	lostErr       error
+}
+
+// LockName returns the name of the Lease locking the preview namespace
+func LockName(previewNamespace string) string {
+	return "preview-" + previewNamespace
+}
+
+// LockSource returns the source of a run for a pull request or for a branch if the number is 0
+func LockSource(owner, repository string, number int, branch string) string {
+	answer := strings.ToLower(owner + "/" + repository)
+	if number > 0 {
+		return answer + "#" + strconv.Itoa(number)
+	}
+	if branch != "" {
+		return answer + "@" + branch
+	}
+	return answer
+}
+
+// NewLockHolder returns a unique identity for this run
+func NewLockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "jx-preview"
+	}
+	return hostname + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// AcquireLock waits until the lock of the preview namespace is taken via a Lease in the namespace.
+// If a run of a newer commit of the same source is waiting or holding the lock then ErrSuperseded is returned
+func AcquireLock(kubeClient kubernetes.Interface, ns, previewNamespace string, owner LockOwner, opts LockOptions) (*Lock, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultLockTimeout
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = DefaultLeaseDuration
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultLockPollInterval
+	}
+	l := &Lock{
+		kubeClient:    kubeClient,
+		ns:            ns,
+		name:          LockName(previewNamespace),
+		owner:         owner,
+		leaseDuration: opts.LeaseDuration,
+	}
+
+	ctx := context.Background()
+	deadline := time.Now().Add(opts.Timeout)
+	logged := false
+	for {
+		acquired, holder, err := l.tryAcquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			l.stop = make(chan struct{})
+			l.done = make(chan struct{})
+			l.lost = make(chan struct{})
+			go l.renew()
+			return l, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for the lock of preview namespace %s held by %s", opts.Timeout.String(), previewNamespace, holder)
+		}
+		if !logged && holder != "" {
+			log.Logger().Infof("waiting for the lock of preview namespace %s held by %s", info(previewNamespace), info(holder))
+			logged = true
+		}
+		time.Sleep(opts.PollInterval)
+	}
+}
+
+// tryAcquire attempts to take the lock returning the current holder if it is held by another run
+func (l *Lock) tryAcquire(ctx context.Context) (bool, string, error) {
+	leaseInterface := l.kubeClient.CoordinationV1().Leases(l.ns)
+	now := metav1.NowMicro()
+	lease, err := leaseInterface.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false, "", fmt.Errorf("failed to get Lease %s in namespace %s: %w", l.name, l.ns, err)
+		}
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      l.name,
+				Namespace: l.ns,
+			},
+		}
+		l.hold(lease, now)
+		_, err = leaseInterface.Create(ctx, lease, metav1.CreateOptions{})
+		if err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return false, "", nil
+			}
+			return false, "", fmt.Errorf("failed to create Lease %s in namespace %s: %w", l.name, l.ns, err)
+		}
+		return true, "", nil
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	// only runs of the same source supersede each other as the previews of other sources may share the namespace
+	nextHolder := lease.Annotations[AnnotationLockNextHolder]
+	nextSameSource := lease.Annotations[AnnotationLockNextSource] == l.owner.Source
+	if holder != l.owner.Holder && nextHolder != "" && nextHolder != l.owner.Holder && nextSameSource && parseOrder(lease.Annotations[AnnotationLockNextOrder]) >= l.owner.Order {
+		return false, holder, fmt.Errorf("run %s is waiting for the lock: %w", nextHolder, ErrSuperseded)
+	}
+
+	if holder == "" || holder == l.owner.Holder || isExpired(lease, now.Time) {
+		l.hold(lease, now)
+		_, err = leaseInterface.Update(ctx, lease, metav1.UpdateOptions{})
+		if err != nil {
+			if apierrors.IsConflict(err) {
+				return false, holder, nil
+			}
+			return false, holder, fmt.Errorf("failed to update Lease %s in namespace %s: %w", l.name, l.ns, err)
+		}
+		return true, holder, nil
+	}
+
+	if lease.Annotations[AnnotationLockSource] == l.owner.Source && l.owner.Order < parseOrder(lease.Annotations[AnnotationLockOrder]) {
+		return false, holder, fmt.Errorf("run %s of commit %s holds the lock: %w", holder, lease.Annotations[AnnotationLockCommit], ErrSuperseded)
+	}
+	if nextHolder == l.owner.Holder || (nextHolder != "" && !nextSameSource) {
+		// lets not replace a run of another source which is waiting for the lock
+		return false, holder, nil
+	}
+
+	// lets register as the next run so that older runs waiting for the lock are superseded
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[AnnotationLockNextHolder] = l.owner.Holder
+	lease.Annotations[AnnotationLockNextOrder] = strconv.FormatInt(l.owner.Order, 10)
+	lease.Annotations[AnnotationLockNextSource] = l.owner.Source
+	_, err = leaseInterface.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil && !apierrors.IsConflict(err) {
+		return false, holder, fmt.Errorf("failed to update Lease %s in namespace %s: %w", l.name, l.ns, err)
+	}
+	return false, holder, nil
+}
+
+// hold modifies the lease so that it is held by the owner
+func (l *Lock) hold(lease *coordinationv1.Lease, now metav1.MicroTime) {
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[AnnotationLockCommit] = l.owner.Commit
+	lease.Annotations[AnnotationLockOrder] = strconv.FormatInt(l.owner.Order, 10)
+	lease.Annotations[AnnotationLockSource] = l.owner.Source
+	if lease.Annotations[AnnotationLockNextHolder] == l.owner.Holder {
+		delete(lease.Annotations, AnnotationLockNextHolder)
+		delete(lease.Annotations, AnnotationLockNextOrder)
+		delete(lease.Annotations, AnnotationLockNextSource)
+	}
+
+	holder := l.owner.Holder
+	seconds := int32(l.leaseDuration.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != holder {
+		transitions := int32(0)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.HolderIdentity = &holder
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+}
+
+// renew renews the lease until the lock is released or lost
+func (l *Lock) renew() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.leaseDuration / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			err := l.renewLease(context.Background())
+			if err == nil {
+				renewed = time.Now()
+				continue
+			}
+			if !errors.Is(err, ErrLockLost) {
+				if time.Since(renewed) <= l.leaseDuration {
+					log.Logger().Warnf("failed to renew the lock %s: %s", l.name, err.Error())
+					continue
+				}
+				// other runs can take the lock once the lease has expired
+				err = fmt.Errorf("lease %s expired: %w: %w", l.name, ErrLockLost, err)
+			}
+			log.Logger().Warnf("the preview is no longer locked: %s", err.Error())
+			l.lostErr = err
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// renewLease renews the lease returning ErrLockLost if it is no longer held by the owner
+func (l *Lock) renewLease(ctx context.Context) error {
+	leaseInterface := l.kubeClient.CoordinationV1().Leases(l.ns)
+	lease, err := leaseInterface.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("lease %s was removed: %w", l.name, ErrLockLost)
+		}
+		return fmt.Errorf("failed to get Lease %s in namespace %s: %w", l.name, l.ns, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.owner.Holder {
+		holder := ""
+		if lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+		return fmt.Errorf("lease %s is held by %q: %w", l.name, holder, ErrLockLost)
+	}
+	l.hold(lease, metav1.NowMicro())
+	_, err = leaseInterface.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update Lease %s in namespace %s: %w", l.name, l.ns, err)
+	}
+	return nil
+}
+
+// Err returns an error wrapping ErrLockLost if the lock could not be renewed so that the run stops
+// before another run deploys into the preview namespace. A nil lock is never lost
+func (l *Lock) Err() error {
+	if l == nil || l.lost == nil {
+		return nil
+	}
+	select {
+	case <-l.lost:
+		return l.lostErr
+	default:
+		return nil
+	}
+}
+
+// Release releases the lock removing the Lease unless another run is waiting for it
+func (l *Lock) Release() error {
+	close(l.stop)
+	<-l.done
+
+	ctx := context.Background()
+	leaseInterface := l.kubeClient.CoordinationV1().Leases(l.ns)
+	lease, err := leaseInterface.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get Lease %s in namespace %s: %w", l.name, l.ns, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.owner.Holder {
+		return nil
+	}
+
+	if lease.Annotations[AnnotationLockNextHolder] == "" {
+		resourceVersion := lease.ResourceVersion
+		err = leaseInterface.Delete(ctx, l.name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion}})
+		if err == nil || apierrors.IsNotFound(err) {
+			return nil
+		}
+		if !apierrors.IsConflict(err) {
+			return fmt.Errorf("failed to delete Lease %s in namespace %s: %w", l.name, l.ns, err)
+		}
+		// another run registered while we were releasing so lets hand over the lock
+		lease, err = leaseInterface.Get(ctx, l.name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get Lease %s in namespace %s: %w", l.name, l.ns, err)
+		}
+	}
+
+	lease.Spec.HolderIdentity = nil
+	lease.Spec.RenewTime = nil
+	_, err = leaseInterface.Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to release Lease %s in namespace %s: %w", l.name, l.ns, err)
+	}
+	return nil
+}
+
+func isExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	spec := &lease.Spec
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+func parseOrder(text string) int64 {
+	order, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return order
+}
@@ -0,0 +1,125 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAcquireLock(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset()
+	opts := previews.LockOptions{Timeout: 5 * time.Second, PollInterval: 10 * time.Millisecond}
+	getLease := func() map[string]string {
+		lease, err := kubeClient.CoordinationV1().Leases(ns).Get(ctx, previews.LockName(previewNamespace), metav1.GetOptions{})
+		require.NoError(t, err, "failed to get lease")
+		return lease.Annotations
+	}
+	acquire := func(holder string, order int64) chan error {
+		ch := make(chan error, 1)
+		go func() {
+			lock, err := previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: holder, Order: order}, opts)
+			if err == nil {
+				err = lock.Release()
+			}
+			ch <- err
+		}()
+		return ch
+	}
+
+	lock, err := previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "a", Commit: "c2", Order: 2}, opts)
+	require.NoError(t, err, "failed to acquire lock")
+	assert.Equal(t, "c2", getLease()[previews.AnnotationLockCommit], "lock commit")
+
+	// an older commit is superseded by the running commit
+	_, err = previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "c", Order: 1}, opts)
+	require.ErrorIs(t, err, previews.ErrSuperseded, "older commit")
+
+	// a waiting run is superseded by a newer commit
+	b := acquire("b", 3)
+	require.Eventually(t, func() bool {
+		return getLease()[previews.AnnotationLockNextHolder] == "b"
+	}, 5*time.Second, 10*time.Millisecond, "b should wait for the lock")
+	d := acquire("d", 4)
+	require.ErrorIs(t, <-b, previews.ErrSuperseded, "waiting older commit")
+	assert.Equal(t, "d", getLease()[previews.AnnotationLockNextHolder], "next holder")
+
+	// the newest commit takes the lock once it is released
+	require.NoError(t, lock.Release(), "failed to release lock")
+	require.NoError(t, <-d, "newest commit should acquire the lock")
+
+	_, err = kubeClient.CoordinationV1().Leases(ns).Get(ctx, previews.LockName(previewNamespace), metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err), "lease should be removed when nothing is waiting")
+}
+
+func TestAcquireLockOtherSource(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-shared"
+	kubeClient := fakekube.NewSimpleClientset()
+	opts := previews.LockOptions{Timeout: 5 * time.Second, PollInterval: 10 * time.Millisecond}
+
+	lock, err := previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "a", Source: previews.LockSource("myowner", "myrepo", 1, ""), Order: 2}, opts)
+	require.NoError(t, err, "failed to acquire lock")
+
+	// an older commit of another pull request sharing the namespace waits rather than being superseded
+	ch := make(chan error, 1)
+	go func() {
+		other, err := previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "b", Source: previews.LockSource("myowner", "other", 1, ""), Order: 1}, opts)
+		if err == nil {
+			err = other.Release()
+		}
+		ch <- err
+	}()
+	require.Eventually(t, func() bool {
+		lease, err := kubeClient.CoordinationV1().Leases(ns).Get(context.Background(), previews.LockName(previewNamespace), metav1.GetOptions{})
+		require.NoError(t, err, "failed to get lease")
+		return lease.Annotations[previews.AnnotationLockNextHolder] == "b"
+	}, 5*time.Second, 10*time.Millisecond, "b should wait for the lock")
+
+	// a newer commit of the first pull request does not supersede the waiting run of the other pull request
+	_, err = previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "c", Source: previews.LockSource("MyOwner", "MyRepo", 1, ""), Order: 1}, opts)
+	require.ErrorIs(t, err, previews.ErrSuperseded, "older commit of the same pull request")
+
+	require.NoError(t, lock.Release(), "failed to release lock")
+	require.NoError(t, <-ch, "the other pull request should acquire the lock")
+}
+
+func TestLockLost(t *testing.T) {
+	ns := "jx"
+	previewNamespace := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset()
+	opts := previews.LockOptions{Timeout: 5 * time.Second, LeaseDuration: 300 * time.Millisecond, PollInterval: 10 * time.Millisecond}
+
+	lock, err := previews.AcquireLock(kubeClient, ns, previewNamespace, previews.LockOwner{Holder: "a", Order: 1}, opts)
+	require.NoError(t, err, "failed to acquire lock")
+	require.NoError(t, lock.Err(), "lock should be held")
+
+	// another run takes over the lease
+	leases := kubeClient.CoordinationV1().Leases(ns)
+	lease, err := leases.Get(ctx, previews.LockName(previewNamespace), metav1.GetOptions{})
+	require.NoError(t, err, "failed to get lease")
+	holder := "b"
+	lease.Spec.HolderIdentity = &holder
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	require.NoError(t, err, "failed to update lease")
+
+	require.Eventually(t, func() bool {
+		return lock.Err() != nil
+	}, 5*time.Second, 10*time.Millisecond, "the lock should be lost")
+	assert.ErrorIs(t, lock.Err(), previews.ErrLockLost, "lost lock error")
+	require.NoError(t, lock.Release(), "failed to release lost lock")
+
+	lease, err = leases.Get(ctx, previews.LockName(previewNamespace), metav1.GetOptions{})
+	require.NoError(t, err, "the lease of the other run should be kept")
+	assert.Equal(t, "b", *lease.Spec.HolderIdentity, "holder")
+}
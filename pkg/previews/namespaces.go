@@ -0,0 +1,68 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// previewNamespaceSuffix matches the suffix of preview namespaces created for pull requests
+var previewNamespaceSuffix = regexp.MustCompile(`-pr-\d+$`)
+
+// EnsurePreviewNamespace lazily creates the preview namespace and makes sure it is labelled with the Preview which owns it
+func EnsurePreviewNamespace(kubeClient kubernetes.Interface, ns, previewNamespace, previewName string) (*corev1.Namespace, error) {
+	ctx := context.Background()
+	namespaceInterface := kubeClient.CoreV1().Namespaces()
+	namespace, err := namespaceInterface.Get(ctx, previewNamespace, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to find preview namespace %s: %w", previewNamespace, err)
+		}
+		namespace = &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: previewNamespace,
+				Labels: map[string]string{
+					LabelPreviewName:      previewName,
+					LabelPreviewNamespace: ns,
+				},
+			},
+		}
+		namespace, err = namespaceInterface.Create(ctx, namespace, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create preview namespace %s: %w", previewNamespace, err)
+		}
+		log.Logger().Infof("created preview namespace %s", info(previewNamespace))
+		return namespace, nil
+	}
+
+	if namespace.Labels[LabelPreviewName] == previewName && namespace.Labels[LabelPreviewNamespace] == ns {
+		return namespace, nil
+	}
+	if namespace.Labels == nil {
+		namespace.Labels = map[string]string{}
+	}
+	namespace.Labels[LabelPreviewName] = previewName
+	namespace.Labels[LabelPreviewNamespace] = ns
+	namespace, err = namespaceInterface.Update(ctx, namespace, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to label preview namespace %s: %w", previewNamespace, err)
+	}
+	return namespace, nil
+}
+
+// IsPreviewNamespace returns true if the namespace is labelled as a preview namespace for Previews in the given namespace
+// or if its name matches the naming convention of preview namespaces
+func IsPreviewNamespace(namespace *corev1.Namespace, ns string) bool {
+	if namespace.Labels[LabelPreviewName] != "" {
+		return namespace.Labels[LabelPreviewNamespace] == ns
+	}
+	name := namespace.Name
+	return name != ns && strings.HasPrefix(name, ns+"-") && previewNamespaceSuffix.MatchString(name)
+}
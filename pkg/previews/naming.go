@@ -0,0 +1,144 @@
+package previews
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultNamespaceTemplate the default template used to name preview namespaces
+	DefaultNamespaceTemplate = "{{ .Namespace }}-{{ .Owner }}-{{ .Repository }}-pr-{{ .Number }}"
+
+	// DefaultBranchNamespaceTemplate the default template used to name the namespaces of branch previews
+	DefaultBranchNamespaceTemplate = "{{ .Namespace }}-{{ .Owner }}-{{ .Repository }}-{{ .Branch }}"
+
+	// MaxNamespaceLength the maximum length of a namespace name
+	MaxNamespaceLength = 63
+
+	hashLength = 8
+)
+
+// ReservedNamespaces the namespaces which are never used for previews as destroying a preview deletes its namespace
+var ReservedNamespaces = []string{"default", "kube-system", "kube-public", "kube-node-lease", "jx-git-operator", "jx-staging", "jx-production"}
+
+// NamespaceNameData the values available to the preview namespace template
+type NamespaceNameData struct {
+	// Namespace the namespace of the Preview resources, usually jx
+	Namespace string
+
+	// Owner the owner of the repository
+	Owner string
+
+	// Repository the name of the repository
+	Repository string
+
+	// Number the pull request number which is zero for branch previews
+	Number int
+
+	// Branch the source branch or the branch or tag of a branch preview
+	Branch string
+
+	// Hash a short hash which uniquely identifies the preview
+	Hash string
+}
+
+// NewNamespaceNameData creates the template data for a preview along with its hash
+func NewNamespaceNameData(ns, owner, repository string, number int, branch string) *NamespaceNameData {
+	id := strings.Join([]string{ns, owner, repository, strconv.Itoa(number), branch}, "/")
+	sum := sha256.Sum256([]byte(id))
+	return &NamespaceNameData{
+		Namespace:  ns,
+		Owner:      owner,
+		Repository: repository,
+		Number:     number,
+		Branch:     branch,
+		Hash:       hex.EncodeToString(sum[:])[:hashLength],
+	}
+}
+
+// NamespaceName evaluates the namespace template. If the result is too long it is truncated and
+// suffixed with the hash of the preview so that different previews never share a namespace.
+// Names which do not start with the namespace of the previews, are reserved or are the namespace of another Preview are rejected
+func NamespaceName(client versioned.Interface, namespaceTemplate string, data *NamespaceNameData) (string, error) {
+	if namespaceTemplate == "" {
+		namespaceTemplate = DefaultNamespaceTemplate
+		if data.Number <= 0 {
+			namespaceTemplate = DefaultBranchNamespaceTemplate
+		}
+	}
+	tmpl, err := template.New("namespace").Option("missingkey=error").Parse(namespaceTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse namespace template %s: %w", namespaceTemplate, err)
+	}
+	buf := &strings.Builder{}
+	err = tmpl.Execute(buf, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to evaluate namespace template %s: %w", namespaceTemplate, err)
+	}
+	name := toNamespaceName(buf.String())
+	if name == "" {
+		return "", fmt.Errorf("namespace template %s evaluated to an empty name", namespaceTemplate)
+	}
+	if len(name) > MaxNamespaceLength {
+		truncated := strings.TrimRight(name[:MaxNamespaceLength-hashLength-1], "-") + "-" + data.Hash
+		log.Logger().Warnf("the preview namespace %s is longer than %d characters so using %s", name, MaxNamespaceLength, info(truncated))
+		name = truncated
+	}
+	err = validateNamespaceName(client, name, data.Namespace)
+	if err != nil {
+		return "", fmt.Errorf("invalid namespace %s from template %s: %w", name, namespaceTemplate, err)
+	}
+	return name, nil
+}
+
+// validateNamespaceName makes sure a new preview never uses a namespace which must not be deleted when the preview is destroyed
+func validateNamespaceName(client versioned.Interface, name, ns string) error {
+	prefix := ns + "-"
+	if !strings.HasPrefix(name, prefix) {
+		return fmt.Errorf("preview namespaces must start with %s", prefix)
+	}
+	for _, reserved := range ReservedNamespaces {
+		if name == reserved {
+			return fmt.Errorf("the namespace is reserved")
+		}
+	}
+	previews, err := client.PreviewV1alpha1().Previews(ns).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Previews in namespace %s: %w", ns, err)
+	}
+	for k := range previews.Items {
+		preview := &previews.Items[k]
+		if preview.Spec.Resources.Namespace == name {
+			return fmt.Errorf("the namespace belongs to Preview %s", preview.Name)
+		}
+	}
+	return nil
+}
+
+// toNamespaceName lower cases the name and replaces any invalid characters with dashes without truncating it
+func toNamespaceName(text string) string {
+	buf := strings.Builder{}
+	dash := false
+	for _, ch := range strings.ToLower(text) {
+		if ch < unicode.MaxASCII && (unicode.IsLetter(ch) || unicode.IsDigit(ch)) {
+			buf.WriteRune(ch)
+			dash = false
+			continue
+		}
+		if !dash && buf.Len() > 0 {
+			buf.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(buf.String(), "-")
+}
@@ -0,0 +1,89 @@
+package previews_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespaceName(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1alpha1.Preview{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myowner-other-pr-1",
+			Namespace: "jx",
+		},
+		Spec: v1alpha1.PreviewSpec{
+			Resources: v1alpha1.Resources{
+				Namespace: "jx-other-pr-1",
+			},
+		},
+	})
+	longRepo := strings.Repeat("a-very-long-repository-name-", 3)
+
+	testCases := []struct {
+		name     string
+		template string
+		data     *previews.NamespaceNameData
+		expected string
+	}{
+		{
+			name:     "default",
+			data:     previews.NewNamespaceNameData("jx", "myowner", "myrepo", 5, "PR-5"),
+			expected: "jx-myowner-myrepo-pr-5",
+		},
+		{
+			name:     "custom",
+			template: "{{ .Namespace }}-preview-{{ .Repository }}-{{ .Branch }}",
+			data:     previews.NewNamespaceNameData("jx", "myowner", "MyRepo", 5, "feature/Cheese"),
+			expected: "jx-preview-myrepo-feature-cheese",
+		},
+		{
+			name:     "branch",
+			data:     previews.NewNamespaceNameData("jx", "myowner", "myrepo", 0, "release/1.2"),
+			expected: "jx-myowner-myrepo-release-1-2",
+		},
+		{
+			name:     "truncated",
+			data:     previews.NewNamespaceNameData("jx", "myowner", longRepo, 5, ""),
+			expected: "jx-myowner-a-very-long-repository-name-a-very-long-rep-" + previews.NewNamespaceNameData("jx", "myowner", longRepo, 5, "").Hash,
+		},
+	}
+
+	for _, tc := range testCases {
+		name, err := previews.NamespaceName(client, tc.template, tc.data)
+		require.NoError(t, err, "for test %s", tc.name)
+		assert.Equal(t, tc.expected, name, "for test %s", tc.name)
+		assert.LessOrEqual(t, len(name), previews.MaxNamespaceLength, "for test %s", tc.name)
+	}
+
+	// truncated names of different previews must not collide
+	a, err := previews.NamespaceName(client, "", previews.NewNamespaceNameData("jx", "myowner", longRepo, 5, ""))
+	require.NoError(t, err)
+	b, err := previews.NamespaceName(client, "", previews.NewNamespaceNameData("jx", "myowner", longRepo, 6, ""))
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b, "truncated namespaces should differ")
+
+	_, err = previews.NamespaceName(client, "{{ .Unknown }}", previews.NewNamespaceNameData("jx", "myowner", "myrepo", 5, ""))
+	assert.Error(t, err, "unknown template fields should fail")
+
+	invalidTestCases := []struct {
+		template string
+		message  string
+	}{
+		{template: "kube-system", message: "system namespaces should be rejected"},
+		{template: "preview-{{ .Repository }}-{{ .Number }}", message: "namespaces without the jx- prefix should be rejected"},
+		{template: "{{ .Namespace }}", message: "the namespace of the previews should be rejected"},
+		{template: "{{ .Namespace }}-staging", message: "reserved namespaces should be rejected"},
+		{template: "{{ .Namespace }}-other-pr-1", message: "the namespace of another preview should be rejected"},
+	}
+	for _, tc := range invalidTestCases {
+		_, err = previews.NamespaceName(client, tc.template, previews.NewNamespaceNameData("jx", "myowner", "myrepo", 5, ""))
+		assert.Error(t, err, tc.message)
+	}
+}
@@ -0,0 +1,189 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// LabelNetworkPolicy the label added to the NetworkPolicies managed by jx-preview
+	LabelNetworkPolicy = "preview.jenkins.io/network-policy"
+
+	// NetworkPolicySameNamespace allows all traffic between pods in the preview namespace
+	NetworkPolicySameNamespace = "jx-preview-same-namespace"
+
+	// NetworkPolicyIngressController allows traffic from the ingress controller
+	NetworkPolicyIngressController = "jx-preview-ingress-controller"
+
+	// NetworkPolicyDNS allows DNS lookups
+	NetworkPolicyDNS = "jx-preview-dns"
+
+	// NetworkPolicyCustom the additional rules configured for the repository
+	NetworkPolicyCustom = "jx-preview-custom"
+)
+
+// DefaultIngressControllerNamespaceSelector selects the namespace the ingress controller is installed into by Jenkins X
+var DefaultIngressControllerNamespaceSelector = &metav1.LabelSelector{
+	MatchLabels: map[string]string{
+		"kubernetes.io/metadata.name": "nginx",
+	},
+}
+
+// ApplyNetworkPolicies creates or updates the NetworkPolicies isolating the preview namespace.
+// If the configuration is disabled any NetworkPolicies previously created are removed
+func ApplyNetworkPolicies(kubeClient kubernetes.Interface, previewNamespace string, cfg *previewconfig.NetworkPolicy) error {
+	ctx := context.Background()
+	policyInterface := kubeClient.NetworkingV1().NetworkPolicies(previewNamespace)
+
+	policies := NetworkPolicies(previewNamespace, cfg)
+	desired := map[string]*networkingv1.NetworkPolicy{}
+	for _, p := range policies {
+		desired[p.Name] = p
+	}
+
+	existing, err := policyInterface.List(ctx, metav1.ListOptions{LabelSelector: LabelNetworkPolicy + "=true"})
+	if err != nil {
+		return fmt.Errorf("failed to list NetworkPolicies in namespace %s: %w", previewNamespace, err)
+	}
+	for i := range existing.Items {
+		current := &existing.Items[i]
+		policy := desired[current.Name]
+		if policy == nil {
+			err = policyInterface.Delete(ctx, current.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete NetworkPolicy %s in namespace %s: %w", current.Name, previewNamespace, err)
+			}
+			continue
+		}
+		delete(desired, current.Name)
+		current.Spec = policy.Spec
+		_, err = policyInterface.Update(ctx, current, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update NetworkPolicy %s in namespace %s: %w", current.Name, previewNamespace, err)
+		}
+	}
+	for _, policy := range policies {
+		if desired[policy.Name] == nil {
+			continue
+		}
+		_, err = policyInterface.Create(ctx, policy, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create NetworkPolicy %s in namespace %s: %w", policy.Name, previewNamespace, err)
+		}
+		log.Logger().Infof("created NetworkPolicy %s in namespace %s", info(policy.Name), info(previewNamespace))
+	}
+	return nil
+}
+
+// NetworkPolicies returns the NetworkPolicies for the preview namespace. As soon as any policy selects the pods
+// all other traffic is denied
+func NetworkPolicies(previewNamespace string, cfg *previewconfig.NetworkPolicy) []*networkingv1.NetworkPolicy {
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	ingressSelector := cfg.IngressControllerNamespaceSelector
+	if ingressSelector == nil {
+		ingressSelector = DefaultIngressControllerNamespaceSelector
+	}
+	udp := corev1.ProtocolUDP
+	tcp := corev1.ProtocolTCP
+	dnsPort := intstr.FromInt32(53)
+	sameNamespace := []networkingv1.NetworkPolicyPeer{
+		{
+			PodSelector: &metav1.LabelSelector{},
+		},
+	}
+
+	answer := []*networkingv1.NetworkPolicy{
+		newNetworkPolicy(previewNamespace, NetworkPolicySameNamespace, networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress, networkingv1.PolicyTypeEgress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: sameNamespace,
+				},
+			},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					To: sameNamespace,
+				},
+			},
+		}),
+		newNetworkPolicy(previewNamespace, NetworkPolicyIngressController, networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: ingressSelector,
+						},
+					},
+				},
+			},
+		}),
+		newNetworkPolicy(previewNamespace, NetworkPolicyDNS, networkingv1.NetworkPolicySpec{
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+			Egress: []networkingv1.NetworkPolicyEgressRule{
+				{
+					To: []networkingv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									"kubernetes.io/metadata.name": "kube-system",
+								},
+							},
+						},
+					},
+					Ports: []networkingv1.NetworkPolicyPort{
+						{
+							Protocol: &udp,
+							Port:     &dnsPort,
+						},
+						{
+							Protocol: &tcp,
+							Port:     &dnsPort,
+						},
+					},
+				},
+			},
+		}),
+	}
+
+	if len(cfg.Ingress) > 0 || len(cfg.Egress) > 0 {
+		spec := networkingv1.NetworkPolicySpec{
+			Ingress: cfg.Ingress,
+			Egress:  cfg.Egress,
+		}
+		if len(cfg.Ingress) > 0 {
+			spec.PolicyTypes = append(spec.PolicyTypes, networkingv1.PolicyTypeIngress)
+		}
+		if len(cfg.Egress) > 0 {
+			spec.PolicyTypes = append(spec.PolicyTypes, networkingv1.PolicyTypeEgress)
+		}
+		answer = append(answer, newNetworkPolicy(previewNamespace, NetworkPolicyCustom, spec))
+	}
+	return answer
+}
+
+func newNetworkPolicy(ns, name string, spec networkingv1.NetworkPolicySpec) *networkingv1.NetworkPolicy {
+	// an empty pod selector applies the policy to all pods in the namespace
+	spec.PodSelector = metav1.LabelSelector{}
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				LabelNetworkPolicy: "true",
+			},
+		},
+		Spec: spec,
+	}
+}
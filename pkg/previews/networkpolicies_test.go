@@ -0,0 +1,123 @@
+package previews_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyNetworkPolicies(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	kubeClient := fakekube.NewSimpleClientset()
+
+	err := previews.ApplyNetworkPolicies(kubeClient, ns, &previewconfig.NetworkPolicy{})
+	require.NoError(t, err, "failed to apply NetworkPolicies")
+
+	policies := listNetworkPolicies(t, kubeClient, ns)
+	require.Equal(t, []string{previews.NetworkPolicyDNS, previews.NetworkPolicyIngressController, previews.NetworkPolicySameNamespace}, policyNames(policies), "default NetworkPolicies")
+	for _, p := range policies {
+		assert.Equal(t, "true", p.Labels[previews.LabelNetworkPolicy], "label of NetworkPolicy %s", p.Name)
+		assert.Equal(t, metav1.LabelSelector{}, p.Spec.PodSelector, "NetworkPolicy %s should select all pods", p.Name)
+	}
+	ingressController := policies[previews.NetworkPolicyIngressController]
+	require.Len(t, ingressController.Spec.Ingress, 1, "ingress controller rules")
+	require.Len(t, ingressController.Spec.Ingress[0].From, 1, "ingress controller peers")
+	assert.Equal(t, previews.DefaultIngressControllerNamespaceSelector, ingressController.Spec.Ingress[0].From[0].NamespaceSelector, "default ingress controller namespace selector")
+}
+
+func TestApplyNetworkPoliciesCustom(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	kubeClient := fakekube.NewSimpleClientset()
+	port := intstr.FromInt32(5432)
+	cfg := &previewconfig.NetworkPolicy{
+		Egress: []networkingv1.NetworkPolicyEgressRule{
+			{
+				Ports: []networkingv1.NetworkPolicyPort{{Port: &port}},
+			},
+		},
+	}
+
+	err := previews.ApplyNetworkPolicies(kubeClient, ns, cfg)
+	require.NoError(t, err, "failed to apply NetworkPolicies")
+
+	policies := listNetworkPolicies(t, kubeClient, ns)
+	custom := policies[previews.NetworkPolicyCustom]
+	require.NotNil(t, custom, "custom NetworkPolicy should be created")
+	assert.Equal(t, cfg.Egress, custom.Spec.Egress, "custom egress rules")
+	assert.Empty(t, custom.Spec.Ingress, "custom ingress rules")
+	assert.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeEgress}, custom.Spec.PolicyTypes, "custom policy types")
+
+	// removing the rules removes the custom policy
+	err = previews.ApplyNetworkPolicies(kubeClient, ns, &previewconfig.NetworkPolicy{})
+	require.NoError(t, err, "failed to apply NetworkPolicies without custom rules")
+	assert.NotContains(t, listNetworkPolicies(t, kubeClient, ns), previews.NetworkPolicyCustom, "custom NetworkPolicy should be removed")
+}
+
+func TestApplyNetworkPoliciesUpdate(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	labels := map[string]string{previews.LabelNetworkPolicy: "true"}
+	kubeClient := fakekube.NewSimpleClientset(
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      previews.NetworkPolicyIngressController,
+				Namespace: ns,
+				Labels:    labels,
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+		&networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "team-policy",
+				Namespace: ns,
+			},
+		},
+	)
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"kubernetes.io/metadata.name": "ingress-nginx"}}
+
+	err := previews.ApplyNetworkPolicies(kubeClient, ns, &previewconfig.NetworkPolicy{IngressControllerNamespaceSelector: selector})
+	require.NoError(t, err, "failed to apply NetworkPolicies")
+
+	policies := listNetworkPolicies(t, kubeClient, ns)
+	assert.Contains(t, policies, "team-policy", "NetworkPolicies not created by jx-preview should be kept")
+	ingressController := policies[previews.NetworkPolicyIngressController]
+	require.NotNil(t, ingressController, "ingress controller NetworkPolicy")
+	require.Len(t, ingressController.Spec.Ingress, 1, "the existing NetworkPolicy should be updated")
+	assert.Equal(t, selector, ingressController.Spec.Ingress[0].From[0].NamespaceSelector, "ingress controller namespace selector")
+
+	// disabling the policies removes the ones created by jx-preview
+	disabled := false
+	err = previews.ApplyNetworkPolicies(kubeClient, ns, &previewconfig.NetworkPolicy{Enabled: &disabled})
+	require.NoError(t, err, "failed to remove NetworkPolicies")
+	assert.Equal(t, []string{"team-policy"}, policyNames(listNetworkPolicies(t, kubeClient, ns)), "remaining NetworkPolicies")
+}
+
+func listNetworkPolicies(t *testing.T, kubeClient kubernetes.Interface, ns string) map[string]*networkingv1.NetworkPolicy {
+	list, err := kubeClient.NetworkingV1().NetworkPolicies(ns).List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err, "failed to list NetworkPolicies")
+	answer := map[string]*networkingv1.NetworkPolicy{}
+	for i := range list.Items {
+		answer[list.Items[i].Name] = &list.Items[i]
+	}
+	return answer
+}
+
+func policyNames(policies map[string]*networkingv1.NetworkPolicy) []string {
+	var names []string
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,6 +3,8 @@ package previews
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
 	"github.com/jenkins-x-plugins/jx-preview/pkg/client/clientset/versioned"
@@ -10,90 +12,200 @@ import (
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
 )
 
 // GetOrCreatePreview lazy creates the preview client and/or the current namespace if not already defined
 func GetOrCreatePreview(client versioned.Interface, ns string, pr *scm.PullRequest, destroyCmd *v1alpha1.Command, gitURL, previewNamespace, path string) (*v1alpha1.Preview, bool, error) {
-	create := false
+	repo := pr.Repository()
+	return upsertPreview(client, ns, destroyCmd, previewNamespace, func(found *v1alpha1.Preview) {
+		src := &found.Spec.Source
+		src.CloneURL = gitURL
+		if repo.Link != "" {
+			src.URL = repo.Link
+		}
+		if src.Ref == "" {
+			src.Ref = pr.Sha
+		}
+		if src.Path == "" {
+			src.Path = path
+		}
+		prr := &found.Spec.PullRequest
+		prr.LatestCommit = pr.Head.Sha
+		if prr.Number <= 0 {
+			prr.Number = pr.Number
+		}
+		if prr.URL == "" {
+			prr.URL = pr.Link
+		}
+		if prr.Owner == "" {
+			prr.Owner = repo.Namespace
+		}
+		if prr.Repository == "" {
+			prr.Repository = repo.Name
+		}
+		if prr.Title == "" {
+			prr.Title = pr.Title
+		}
+		if prr.Description == "" {
+			prr.Description = pr.Body
+		}
+		if prr.User.Username == "" {
+			prr.User.Username = pr.Author.Login
+		}
+	})
+}
+
+// GetOrCreateBranchPreview creates or updates the Preview for a branch or tag of a repository
+func GetOrCreateBranchPreview(client versioned.Interface, ns, owner, repository string, branch *v1alpha1.PreviewBranch, destroyCmd *v1alpha1.Command, gitURL, repoLink, previewNamespace, path string) (*v1alpha1.Preview, bool, error) {
+	return upsertPreview(client, ns, destroyCmd, previewNamespace, func(found *v1alpha1.Preview) {
+		src := &found.Spec.Source
+		src.CloneURL = gitURL
+		if repoLink != "" {
+			src.URL = repoLink
+		}
+		src.Ref = branch.Name
+		if src.Path == "" {
+			src.Path = path
+		}
+		prr := &found.Spec.PullRequest
+		prr.Owner = owner
+		prr.Repository = repository
+		found.Spec.Branch = branch
+	})
+}
 
+// upsertPreview gets the Preview by name and creates it or applies the fields modified by fn using server-side apply
+func upsertPreview(client versioned.Interface, ns string, destroyCmd *v1alpha1.Command, previewNamespace string, fn func(*v1alpha1.Preview)) (*v1alpha1.Preview, bool, error) {
 	ctx := context.Background()
 	previewInterface := client.PreviewV1alpha1().Previews(ns)
-	previews, err := previewInterface.List(ctx, metav1.ListOptions{})
+	create := false
+	var answer *v1alpha1.Preview
+	err := retry.OnError(retry.DefaultRetry, isUpsertConflict, func() error {
+		found, err := previewInterface.Get(ctx, previewNamespace, metav1.GetOptions{})
+		create = apierrors.IsNotFound(err)
+		if err != nil && !create {
+			return fmt.Errorf("failed to get Preview %s in namespace %s: %w", previewNamespace, ns, err)
+		}
+
+		// lets only include the fields we manage so we do not take ownership of fields written by others
+		preview := &v1alpha1.Preview{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      previewNamespace,
+				Namespace: ns,
+				Annotations: map[string]string{
+					AnnotationLastUpdated: time.Now().UTC().Format(time.RFC3339),
+				},
+			},
+		}
+		if !create {
+			// lets fail with a conflict and read the preview again if another writer modifies it before it is applied
+			preview.ResourceVersion = found.ResourceVersion
+			preview.Spec.Source = found.Spec.Source
+			preview.Spec.PullRequest = found.Spec.PullRequest
+			preview.Spec.Branch = found.Spec.Branch.DeepCopy()
+		}
+		fn(preview)
+		if previewNamespace != "" {
+			preview.Spec.Resources.Namespace = previewNamespace
+		}
+		preview.Spec.DestroyCommand = *destroyCmd
+
+		if create {
+			answer, err = previewInterface.Create(ctx, preview, metav1.CreateOptions{FieldManager: FieldManager})
+			if err != nil {
+				return fmt.Errorf("failed to create Preview %s: %w", preview.Name, err)
+			}
+			return nil
+		}
+		answer, err = ApplyPreview(client, preview, FieldManager)
+		return err
+	})
+	if err != nil {
+		return nil, create, err
+	}
+	return answer, create, nil
+}
+
+// isUpsertConflict returns true if another writer created the Preview or modified it since it was read
+func isUpsertConflict(err error) bool {
+	return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+}
+
+// FindPullRequestPreview returns the Preview of the pull request or nil if there is none
+func FindPullRequestPreview(client versioned.Interface, ns, owner, repository string, number int) (*v1alpha1.Preview, error) {
+	previews, err := client.PreviewV1alpha1().Previews(ns).List(context.Background(), metav1.ListOptions{})
 	if err != nil {
 		if apierrors.IsNotFound(err) {
-			err = nil
+			return nil, nil
 		}
+		return nil, fmt.Errorf("failed to list Previews in namespace %s: %w", ns, err)
 	}
-	if err != nil {
-		return nil, create, fmt.Errorf("failed to list Previews in namespace %s: %w", ns, err)
+	for i := range previews.Items {
+		preview := &previews.Items[i]
+		prr := &preview.Spec.PullRequest
+		if preview.Spec.Branch == nil && prr.Number == number && strings.EqualFold(prr.Owner, owner) && strings.EqualFold(prr.Repository, repository) {
+			return preview, nil
+		}
 	}
+	return nil, nil
+}
 
-	repo := pr.Repository()
-	var found *v1alpha1.Preview
+// FindBranchPreview returns the Preview of the branch or tag or nil if there is none
+func FindBranchPreview(client versioned.Interface, ns, owner, repository, branch string) (*v1alpha1.Preview, error) {
+	previews, err := client.PreviewV1alpha1().Previews(ns).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list Previews in namespace %s: %w", ns, err)
+	}
 	for i := range previews.Items {
 		preview := &previews.Items[i]
-		if preview.Name == previewNamespace {
-			found = preview
-			break
+		prr := &preview.Spec.PullRequest
+		if preview.Spec.Branch != nil && preview.Spec.Branch.Name == branch && strings.EqualFold(prr.Owner, owner) && strings.EqualFold(prr.Repository, repository) {
+			return preview, nil
 		}
 	}
-	if found == nil {
-		create = true
-		found = &v1alpha1.Preview{
+	return nil, nil
+}
+
+// UpdateLinkedPullRequests adds or updates the linked pull requests of the Preview resource
+func UpdateLinkedPullRequests(client versioned.Interface, ns, name string, links ...v1alpha1.PullRequest) (*v1alpha1.Preview, error) {
+	ctx := context.Background()
+	previewInterface := client.PreviewV1alpha1().Previews(ns)
+	var answer *v1alpha1.Preview
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		preview, err := previewInterface.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get Preview %s in namespace %s: %w", name, ns, err)
+		}
+		answer = preview
+		if !AddLinkedPullRequests(preview, links...) {
+			return nil
+		}
+		applied := &v1alpha1.Preview{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      previewNamespace,
+				Name:      name,
 				Namespace: ns,
+				Annotations: map[string]string{
+					AnnotationLastUpdated: time.Now().UTC().Format(time.RFC3339),
+				},
 			},
 		}
-	}
-	if found.Namespace == "" {
-		found.Namespace = ns
-	}
-	src := &found.Spec.Source
-	src.CloneURL = gitURL
-	if repo.Link != "" {
-		src.URL = repo.Link
-	}
-	if src.Ref == "" {
-		src.Ref = pr.Sha
-	}
-	if src.Path == "" {
-		src.Path = path
-	}
-	prr := &found.Spec.PullRequest
-	prr.LatestCommit = pr.Head.Sha
-	if prr.Number <= 0 {
-		prr.Number = pr.Number
-	}
-	if prr.URL == "" {
-		prr.URL = pr.Link
-	}
-	if prr.Owner == "" {
-		prr.Owner = repo.Namespace
-	}
-	if prr.Repository == "" {
-		prr.Repository = repo.Name
-	}
-	if prr.Title == "" {
-		prr.Title = pr.Title
-	}
-	if prr.Description == "" {
-		prr.Description = pr.Body
-	}
-	if previewNamespace != "" {
-		found.Spec.Resources.Namespace = previewNamespace
-	}
-	found.Spec.DestroyCommand = *destroyCmd
-	if create {
-		found, err = previewInterface.Create(ctx, found, metav1.CreateOptions{})
+		applied.Spec.LinkedPullRequests = preview.Spec.LinkedPullRequests
+		obj, err := applyConfiguration(applied)
 		if err != nil {
-			return found, create, fmt.Errorf("failed to create Preview %s: %w", found.Name, err)
+			return err
 		}
-		return found, create, nil
-	}
-	found, err = previewInterface.Update(ctx, found, metav1.UpdateOptions{})
+		delete(obj, "status")
+		// lets fail with a conflict if another run has linked a pull request since we read the preview
+		obj["metadata"].(map[string]interface{})["resourceVersion"] = preview.ResourceVersion
+		answer, err = apply(client, applied, LinksFieldManager, obj)
+		return err
+	})
 	if err != nil {
-		return found, create, fmt.Errorf("failed to update Preview %s: %w", found.Name, err)
+		return nil, err
 	}
-	return found, create, nil
+	return answer, nil
 }
@@ -0,0 +1,178 @@
+package previews
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationClusterIssuer the cert-manager annotation for the ClusterIssuer of the certificate of an Ingress
+	AnnotationClusterIssuer = "cert-manager.io/cluster-issuer"
+
+	// AnnotationIssuer the cert-manager annotation for the Issuer of the certificate of an Ingress
+	AnnotationIssuer = "cert-manager.io/issuer"
+)
+
+// CertificatesResource the resource of cert-manager Certificates
+var CertificatesResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+// ApplyIngressTLS configures TLS on the Ingresses in the preview namespace. Ingresses without TLS use the wildcard
+// certificate Secret if one is configured or otherwise a Secret per Ingress issued by cert-manager.
+// Returns the names of the TLS Secrets and the hosts served over TLS by the Ingresses
+func ApplyIngressTLS(kubeClient kubernetes.Interface, previewNamespace string, cfg *previewconfig.TLS) ([]string, []string, error) {
+	if !cfg.IsEnabled() {
+		return nil, nil, nil
+	}
+	ctx := context.Background()
+	ingressInterface := kubeClient.NetworkingV1().Ingresses(previewNamespace)
+	list, err := ingressInterface.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list Ingresses in namespace %s: %w", previewNamespace, err)
+	}
+
+	secretNames := map[string]bool{}
+	var tlsHosts []string
+	for i := range list.Items {
+		ing := &list.Items[i]
+		hosts := ingressHosts(ing)
+		if len(hosts) == 0 {
+			continue
+		}
+
+		modified := false
+		if len(ing.Spec.TLS) == 0 {
+			secretName := cfg.SecretName
+			if secretName == "" {
+				secretName = ing.Name + "-tls"
+			}
+			ing.Spec.TLS = []networkingv1.IngressTLS{
+				{
+					Hosts:      hosts,
+					SecretName: secretName,
+				},
+			}
+			modified = true
+		}
+		if cfg.SecretName == "" {
+			annotation := AnnotationClusterIssuer
+			if cfg.GetIssuerKind() == previewconfig.IssuerKindIssuer {
+				annotation = AnnotationIssuer
+			}
+			if ing.Annotations == nil {
+				ing.Annotations = map[string]string{}
+			}
+			if ing.Annotations[annotation] != cfg.Issuer {
+				ing.Annotations[annotation] = cfg.Issuer
+				modified = true
+			}
+		}
+		for _, t := range ing.Spec.TLS {
+			if t.SecretName != "" {
+				secretNames[t.SecretName] = true
+			}
+			tlsHosts = append(tlsHosts, t.Hosts...)
+		}
+		if !modified {
+			continue
+		}
+		_, err = ingressInterface.Update(ctx, ing, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update Ingress %s in namespace %s: %w", ing.Name, previewNamespace, err)
+		}
+		log.Logger().Infof("configured TLS for Ingress %s in namespace %s", info(ing.Name), info(previewNamespace))
+	}
+
+	var answer []string
+	for name := range secretNames {
+		answer = append(answer, name)
+	}
+	sort.Strings(answer)
+	return answer, tlsHosts, nil
+}
+
+// WaitForCertificates waits for the cert-manager Certificates of the given Secrets to become Ready
+func WaitForCertificates(dynamicClient dynamic.Interface, previewNamespace string, names []string, timeout time.Duration) error {
+	if len(names) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	certificates := dynamicClient.Resource(CertificatesResource).Namespace(previewNamespace)
+
+	log.Logger().Infof("waiting for certificates %s in namespace %s to be ready", info(strings.Join(names, ", ")), info(previewNamespace))
+	var notReady []string
+	fn := func() error {
+		notReady = nil
+		for _, name := range names {
+			cert, err := certificates.Get(ctx, name, metav1.GetOptions{})
+			if err != nil || !IsCertificateReady(cert) {
+				notReady = append(notReady, name)
+			}
+		}
+		if len(notReady) > 0 {
+			return fmt.Errorf("certificates %s are not ready", strings.Join(notReady, ", "))
+		}
+		return nil
+	}
+
+	bo := backoff.NewExponentialBackOff()
+	bo.MaxElapsedTime = timeout
+	bo.Reset()
+	err := backoff.Retry(fn, bo)
+	if err != nil {
+		return fmt.Errorf("failed to wait for certificates in namespace %s in timeout %v: %w", previewNamespace, timeout, err)
+	}
+	return nil
+}
+
+// IsCertificateReady returns true if the cert-manager Certificate has a Ready condition which is True
+func IsCertificateReady(cert *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]interface{})
+		if ok && m["type"] == "Ready" {
+			return m["status"] == "True"
+		}
+	}
+	return false
+}
+
+// ToHTTPS returns the URL using the https scheme if its host is one of the given TLS hosts
+func ToHTTPS(url string, tlsHosts []string) string {
+	if !strings.HasPrefix(url, "http://") {
+		return url
+	}
+	rest := strings.TrimPrefix(url, "http://")
+	host := rest
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	for _, h := range tlsHosts {
+		if strings.EqualFold(h, host) {
+			return "https://" + rest
+		}
+	}
+	return url
+}
+
+func ingressHosts(ing *networkingv1.Ingress) []string {
+	var hosts []string
+	for _, rule := range ing.Spec.Rules {
+		if rule.Host != "" {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,99 @@
+package previews_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplyIngressTLS(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	newIngress := func(name, host string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{
+					{
+						Host: host,
+					},
+				},
+			},
+		}
+	}
+
+	ctx := context.Background()
+	kubeClient := fakekube.NewSimpleClientset(newIngress("api", "api-pr-1.example.com"), newIngress("internal", ""))
+	secretNames, tlsHosts, err := previews.ApplyIngressTLS(kubeClient, ns, &previewconfig.TLS{Enabled: true, Issuer: "letsencrypt"})
+	require.NoError(t, err, "failed to apply TLS")
+	assert.Equal(t, []string{"api-tls"}, secretNames, "TLS secret names")
+	assert.Equal(t, []string{"api-pr-1.example.com"}, tlsHosts, "TLS hosts")
+
+	ing, err := kubeClient.NetworkingV1().Ingresses(ns).Get(ctx, "api", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get ingress")
+	assert.Equal(t, "letsencrypt", ing.Annotations[previews.AnnotationClusterIssuer], "issuer annotation")
+	require.Len(t, ing.Spec.TLS, 1, "ingress TLS")
+	assert.Equal(t, []string{"api-pr-1.example.com"}, ing.Spec.TLS[0].Hosts, "TLS hosts")
+
+	ing, err = kubeClient.NetworkingV1().Ingresses(ns).Get(ctx, "internal", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get ingress")
+	assert.Empty(t, ing.Spec.TLS, "ingresses without hosts should not use TLS")
+
+	// a wildcard certificate is used without an issuer
+	kubeClient = fakekube.NewSimpleClientset(newIngress("api", "api-pr-1.example.com"))
+	secretNames, _, err = previews.ApplyIngressTLS(kubeClient, ns, &previewconfig.TLS{Enabled: true, SecretName: "wildcard-tls"})
+	require.NoError(t, err, "failed to apply TLS")
+	assert.Equal(t, []string{"wildcard-tls"}, secretNames, "TLS secret names")
+
+	ing, err = kubeClient.NetworkingV1().Ingresses(ns).Get(ctx, "api", metav1.GetOptions{})
+	require.NoError(t, err, "failed to get ingress")
+	assert.Empty(t, ing.Annotations[previews.AnnotationClusterIssuer], "issuer annotation")
+}
+
+func TestWaitForCertificates(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	newCertificate := func(name, status string) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{Object: map[string]interface{}{
+			"status": map[string]interface{}{
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Ready", "status": status},
+				},
+			},
+		}}
+		u.SetAPIVersion("cert-manager.io/v1")
+		u.SetKind("Certificate")
+		u.SetNamespace(ns)
+		u.SetName(name)
+		return u
+	}
+
+	dynamicClient := dynfake.NewSimpleDynamicClient(runtime.NewScheme(), newCertificate("api-tls", "True"), newCertificate("ui-tls", "False"))
+
+	err := previews.WaitForCertificates(dynamicClient, ns, []string{"api-tls"}, time.Second)
+	require.NoError(t, err, "ready certificate")
+
+	err = previews.WaitForCertificates(dynamicClient, ns, []string{"api-tls", "ui-tls"}, time.Second)
+	require.Error(t, err, "certificate should not be ready")
+	assert.Contains(t, err.Error(), "ui-tls")
+}
+
+func TestToHTTPS(t *testing.T) {
+	tlsHosts := []string{"api-pr-1.example.com"}
+	assert.Equal(t, "https://api-pr-1.example.com", previews.ToHTTPS("http://api-pr-1.example.com", tlsHosts), "TLS host")
+	assert.Equal(t, "https://api-pr-1.example.com/health", previews.ToHTTPS("http://api-pr-1.example.com/health", tlsHosts), "TLS host with a path")
+	assert.Equal(t, "http://ui-pr-1.example.com", previews.ToHTTPS("http://ui-pr-1.example.com", tlsHosts), "host without TLS")
+	assert.Equal(t, "http://api-pr-1.example.com.other.io", previews.ToHTTPS("http://api-pr-1.example.com.other.io", tlsHosts), "host with a TLS host prefix")
+}
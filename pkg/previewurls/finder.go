@@ -0,0 +1,72 @@
+package previewurls
+
+import (
+	"context"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	kserve "knative.dev/serving/pkg/client/clientset/versioned"
+)
+
+// Finder finds the URLs of the resources in a preview namespace
+type Finder interface {
+	// FindURLs finds the URLs in the namespace
+	FindURLs(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error)
+}
+
+// FinderFunc a function which implements Finder
+type FinderFunc func(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error)
+
+// FindURLs finds the URLs in the namespace
+func (f FinderFunc) FindURLs(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+	return f(ctx, ns)
+}
+
+// Chain combines the URLs of a number of finders sorted by name
+type Chain []Finder
+
+// FindURLs finds the URLs of all the finders in the namespace
+func (c Chain) FindURLs(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+	var answer []v1alpha1.PreviewURL
+	for _, f := range c {
+		urls, err := f.FindURLs(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, urls...)
+	}
+	SortURLs(answer)
+	return answer, nil
+}
+
+// NewIngressFinder creates a Finder of the URLs of Ingresses
+func NewIngressFinder(kubeClient kubernetes.Interface) Finder {
+	return FinderFunc(func(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+		return IngressURLs(ctx, kubeClient, ns)
+	})
+}
+
+// NewRouteFinder creates a Finder of the URLs of OpenShift Routes
+func NewRouteFinder(dynamicClient dynamic.Interface) Finder {
+	return FinderFunc(func(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+		return RouteURLs(ctx, dynamicClient, ns)
+	})
+}
+
+// NewHTTPRouteFinder creates a Finder of the URLs of Gateway API HTTPRoutes
+func NewHTTPRouteFinder(dynamicClient dynamic.Interface) Finder {
+	return FinderFunc(func(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+		return HTTPRouteURLs(ctx, dynamicClient, ns)
+	})
+}
+
+// NewDefaultFinder creates a Finder of the URLs of Ingresses, OpenShift Routes, Gateway API HTTPRoutes and Knative Services
+func NewDefaultFinder(kubeClient kubernetes.Interface, dynamicClient dynamic.Interface, kserveClient kserve.Interface) Finder {
+	return Chain{
+		NewIngressFinder(kubeClient),
+		NewRouteFinder(dynamicClient),
+		NewHTTPRouteFinder(dynamicClient),
+		NewKnativeServiceFinder(kserveClient),
+	}
+}
@@ -0,0 +1,213 @@
+package previewurls
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// KindHTTPRoute the kind of URLs of Gateway API HTTPRoutes
+const KindHTTPRoute = "HTTPRoute"
+
+var (
+	// HTTPRoutesResource the resource of Gateway API HTTPRoutes
+	HTTPRoutesResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+
+	// GatewaysResource the resource of Gateway API Gateways
+	GatewaysResource = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+)
+
+// listener the subset of a Gateway listener used to create URLs
+type listener struct {
+	name     string
+	hostname string
+	protocol string
+	port     int64
+}
+
+// HTTPRouteURLs returns the URLs of the hostnames of the HTTPRoutes in the namespace using the scheme and port of
+// the listeners of their parent Gateways. If the Gateway API is not installed no URLs are returned
+func HTTPRouteURLs(ctx context.Context, dynamicClient dynamic.Interface, ns string) ([]v1alpha1.PreviewURL, error) {
+	list, err := dynamicClient.Resource(HTTPRoutesResource).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list HTTPRoutes in namespace %s: %w", ns, err)
+	}
+
+	gateways := map[string][]listener{}
+	var answer []v1alpha1.PreviewURL
+	for i := range list.Items {
+		route := &list.Items[i]
+		listeners, err := parentListeners(ctx, dynamicClient, route, gateways)
+		if err != nil {
+			return nil, err
+		}
+
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+		if len(hostnames) == 0 {
+			// lets default to the hostnames of the listeners
+			for _, l := range listeners {
+				if l.hostname != "" {
+					hostnames = append(hostnames, l.hostname)
+				}
+			}
+		}
+		path := httpRoutePath(route)
+
+		count := 0
+		for _, host := range hostnames {
+			if host == "" || strings.HasPrefix(host, "*") {
+				continue
+			}
+			count++
+			name := route.GetName()
+			if count > 1 {
+				name = fmt.Sprintf("%s-%d", route.GetName(), count)
+			}
+			l := matchListener(listeners, host)
+			url := toURL(l.protocol == "HTTPS", host+portSuffix(l), path)
+			answer = append(answer, v1alpha1.PreviewURL{
+				Name: name,
+				URL:  url,
+				Kind: KindHTTPRoute,
+			})
+		}
+	}
+	return answer, nil
+}
+
+// parentListeners returns the listeners of the parent Gateways of the HTTPRoute caching the Gateways by key
+func parentListeners(ctx context.Context, dynamicClient dynamic.Interface, route *unstructured.Unstructured, gateways map[string][]listener) ([]listener, error) {
+	parentRefs, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+	var answer []listener
+	for _, p := range parentRefs {
+		ref, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _, _ := unstructured.NestedString(ref, "kind")
+		if kind != "" && kind != "Gateway" {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(ref, "name")
+		if name == "" {
+			continue
+		}
+		gatewayNamespace, _, _ := unstructured.NestedString(ref, "namespace")
+		if gatewayNamespace == "" {
+			gatewayNamespace = route.GetNamespace()
+		}
+		sectionName, _, _ := unstructured.NestedString(ref, "sectionName")
+
+		key := gatewayNamespace + "/" + name
+		listeners, cached := gateways[key]
+		if !cached {
+			gateway, err := dynamicClient.Resource(GatewaysResource).Namespace(gatewayNamespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				if !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) {
+					return nil, fmt.Errorf("failed to get Gateway %s in namespace %s: %w", name, gatewayNamespace, err)
+				}
+				gateway = nil
+			}
+			listeners = gatewayListeners(gateway)
+			gateways[key] = listeners
+		}
+		for _, l := range listeners {
+			if sectionName == "" || l.name == sectionName {
+				answer = append(answer, l)
+			}
+		}
+	}
+	return answer, nil
+}
+
+func gatewayListeners(gateway *unstructured.Unstructured) []listener {
+	if gateway == nil {
+		return nil
+	}
+	items, _, _ := unstructured.NestedSlice(gateway.Object, "spec", "listeners")
+	var answer []listener
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		l := listener{}
+		l.name, _, _ = unstructured.NestedString(m, "name")
+		l.hostname, _, _ = unstructured.NestedString(m, "hostname")
+		l.protocol, _, _ = unstructured.NestedString(m, "protocol")
+		l.port, _, _ = unstructured.NestedInt64(m, "port")
+		if l.protocol == "HTTP" || l.protocol == "HTTPS" {
+			answer = append(answer, l)
+		}
+	}
+	return answer
+}
+
+// matchListener returns the listener for the host preferring HTTPS listeners
+func matchListener(listeners []listener, host string) listener {
+	answer := listener{protocol: "HTTP"}
+	found := false
+	for _, l := range listeners {
+		if !hostnameMatches(l.hostname, host) {
+			continue
+		}
+		if !found || (l.protocol == "HTTPS" && answer.protocol != "HTTPS") {
+			answer = l
+			found = true
+		}
+	}
+	return answer
+}
+
+func hostnameMatches(pattern, host string) bool {
+	switch {
+	case pattern == "":
+		return true
+	case strings.HasPrefix(pattern, "*."):
+		return strings.HasSuffix(host, pattern[1:])
+	default:
+		return pattern == host
+	}
+}
+
+func portSuffix(l listener) string {
+	if l.port == 0 || (l.protocol == "HTTP" && l.port == 80) || (l.protocol == "HTTPS" && l.port == 443) {
+		return ""
+	}
+	return fmt.Sprintf(":%d", l.port)
+}
+
+// httpRoutePath returns the path of the first rule which matches a path prefix or an exact path
+func httpRoutePath(route *unstructured.Unstructured) string {
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		matches, _, _ := unstructured.NestedSlice(rule, "matches")
+		for _, m := range matches {
+			match, ok := m.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			pathType, _, _ := unstructured.NestedString(match, "path", "type")
+			value, _, _ := unstructured.NestedString(match, "path", "value")
+			if pathType == "RegularExpression" {
+				continue
+			}
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package previewurls_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewurls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHTTPRouteURLs(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	ctx := context.Background()
+	dynamicClient := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			previewurls.RoutesResource:     "RouteList",
+			previewurls.HTTPRoutesResource: "HTTPRouteList",
+		},
+		newUnstructured("gateway.networking.k8s.io/v1", "HTTPRoute", ns, "api", map[string]interface{}{
+			"parentRefs": []interface{}{
+				map[string]interface{}{"name": "external", "namespace": "gateways"},
+			},
+			"hostnames": []interface{}{"api-pr-1.example.com", "api-pr-1.other.com"},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"matches": []interface{}{
+						map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/api"}},
+					},
+				},
+			},
+		}),
+		newUnstructured("gateway.networking.k8s.io/v1", "HTTPRoute", ns, "admin", map[string]interface{}{
+			"parentRefs": []interface{}{
+				map[string]interface{}{"name": "external", "namespace": "gateways", "sectionName": "admin"},
+			},
+		}),
+		newUnstructured("gateway.networking.k8s.io/v1", "HTTPRoute", ns, "orphan", map[string]interface{}{
+			"parentRefs": []interface{}{
+				map[string]interface{}{"name": "missing"},
+			},
+			"hostnames": []interface{}{"orphan-pr-1.example.com"},
+		}),
+	)
+
+	// the fake client guesses the wrong resource name for Gateways so lets create it explicitly
+	_, err := dynamicClient.Resource(previewurls.GatewaysResource).Namespace("gateways").Create(ctx, newUnstructured("gateway.networking.k8s.io/v1", "Gateway", "gateways", "external", map[string]interface{}{
+		"listeners": []interface{}{
+			map[string]interface{}{"name": "http", "protocol": "HTTP", "port": int64(80)},
+			map[string]interface{}{"name": "https", "protocol": "HTTPS", "port": int64(443), "hostname": "*.example.com"},
+			map[string]interface{}{"name": "admin", "protocol": "HTTPS", "port": int64(8443), "hostname": "admin-pr-1.internal.com"},
+		},
+	}), metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create Gateway")
+
+	kubeClient := fakekube.NewSimpleClientset(&networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "ui", Namespace: ns},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{Host: "ui-pr-1.example.com"}},
+		},
+	})
+	finder := previewurls.Chain{
+		previewurls.NewIngressFinder(kubeClient),
+		previewurls.NewRouteFinder(dynamicClient),
+		previewurls.NewHTTPRouteFinder(dynamicClient),
+	}
+
+	urls, err := finder.FindURLs(ctx, ns)
+	require.NoError(t, err, "failed to find URLs")
+	assert.Equal(t, []v1alpha1.PreviewURL{
+		{Name: "admin", URL: "https://admin-pr-1.internal.com:8443", Kind: previewurls.KindHTTPRoute},
+		{Name: "api", URL: "https://api-pr-1.example.com/api", Kind: previewurls.KindHTTPRoute},
+		{Name: "api-2", URL: "http://api-pr-1.other.com/api", Kind: previewurls.KindHTTPRoute},
+		{Name: "orphan", URL: "http://orphan-pr-1.example.com", Kind: previewurls.KindHTTPRoute},
+		{Name: "ui", URL: "http://ui-pr-1.example.com", Kind: previewurls.KindIngress},
+	}, urls)
+}
+
+func newUnstructured(apiVersion, kind, ns, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": spec,
+	}}
+	u.SetAPIVersion(apiVersion)
+	u.SetKind(kind)
+	u.SetNamespace(ns)
+	u.SetName(name)
+	return u
+}
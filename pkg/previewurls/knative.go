@@ -0,0 +1,47 @@
+package previewurls
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/kserving"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kserve "knative.dev/serving/pkg/client/clientset/versioned"
+)
+
+// NewKnativeServiceFinder creates a Finder of the URLs of Knative Services
+func NewKnativeServiceFinder(kserveClient kserve.Interface) Finder {
+	return FinderFunc(func(ctx context.Context, ns string) ([]v1alpha1.PreviewURL, error) {
+		return KnativeServiceURLs(ctx, kserveClient, ns)
+	})
+}
+
+// KnativeServiceURLs returns the URLs of the Knative Services in the namespace
+func KnativeServiceURLs(ctx context.Context, kserveClient kserve.Interface, ns string) ([]v1alpha1.PreviewURL, error) {
+	if kserveClient == nil {
+		return nil, nil
+	}
+	list, err := kserveClient.ServingV1().Services(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// Knative is not installed
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list Knative Services in namespace %s: %w", ns, err)
+	}
+	var answer []v1alpha1.PreviewURL
+	for i := range list.Items {
+		url := kserving.GetServiceURL(&list.Items[i])
+		if url == "" {
+			continue
+		}
+		answer = append(answer, v1alpha1.PreviewURL{
+			Name: list.Items[i].Name,
+			URL:  url,
+			Kind: KindKnativeService,
+		})
+	}
+	return answer, nil
+}
@@ -0,0 +1,164 @@
+package previewurls
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// KindIngress the kind of URLs of Ingresses
+	KindIngress = "Ingress"
+
+	// KindRoute the kind of URLs of OpenShift Routes
+	KindRoute = "Route"
+
+	// KindKnativeService the kind of URLs of Knative Services
+	KindKnativeService = "Service"
+
+	// EnvVarPrefix the prefix of the environment variables of the named URLs of a preview
+	EnvVarPrefix = "PREVIEW_URL_"
+)
+
+var (
+	// RoutesResource the resource of OpenShift Routes
+	RoutesResource = schema.GroupVersionResource{Group: "route.openshift.io", Version: "v1", Resource: "routes"}
+
+	invalidEnvVarChars = regexp.MustCompile(`[^A-Z0-9_]`)
+)
+
+// IngressURLs returns the URLs of the hosts of the Ingresses in the namespace
+func IngressURLs(ctx context.Context, kubeClient kubernetes.Interface, ns string) ([]v1alpha1.PreviewURL, error) {
+	list, err := kubeClient.NetworkingV1().Ingresses(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Ingresses in namespace %s: %w", ns, err)
+	}
+	var answer []v1alpha1.PreviewURL
+	for i := range list.Items {
+		ing := &list.Items[i]
+		count := 0
+		for _, rule := range ing.Spec.Rules {
+			if rule.Host == "" {
+				continue
+			}
+			count++
+			name := ing.Name
+			if count > 1 {
+				name = fmt.Sprintf("%s-%d", ing.Name, count)
+			}
+			answer = append(answer, v1alpha1.PreviewURL{
+				Name: name,
+				URL:  toURL(ingressHasTLS(ing, rule.Host), rule.Host, rulePath(rule)),
+				Kind: KindIngress,
+			})
+		}
+	}
+	return answer, nil
+}
+
+// RouteURLs returns the URLs of the OpenShift Routes in the namespace. If Routes are not supported by the cluster
+// no URLs are returned
+func RouteURLs(ctx context.Context, dynamicClient dynamic.Interface, ns string) ([]v1alpha1.PreviewURL, error) {
+	list, err := dynamicClient.Resource(RoutesResource).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list Routes in namespace %s: %w", ns, err)
+	}
+	var answer []v1alpha1.PreviewURL
+	for i := range list.Items {
+		route := &list.Items[i]
+		host, _, _ := unstructured.NestedString(route.Object, "spec", "host")
+		if host == "" {
+			continue
+		}
+		path, _, _ := unstructured.NestedString(route.Object, "spec", "path")
+		_, tls, _ := unstructured.NestedMap(route.Object, "spec", "tls")
+		answer = append(answer, v1alpha1.PreviewURL{
+			Name: route.GetName(),
+			URL:  toURL(tls, host, path),
+			Kind: KindRoute,
+		})
+	}
+	return answer, nil
+}
+
+// SortURLs sorts the URLs by name and kind
+func SortURLs(urls []v1alpha1.PreviewURL) {
+	sort.SliceStable(urls, func(i, j int) bool {
+		if urls[i].Name != urls[j].Name {
+			return urls[i].Name < urls[j].Name
+		}
+		return urls[i].Kind < urls[j].Kind
+	})
+}
+
+// FindURL returns the URL with the given name or an empty string if there is no such URL
+func FindURL(urls []v1alpha1.PreviewURL, name string) string {
+	for i := range urls {
+		if urls[i].Name == name {
+			return urls[i].URL
+		}
+	}
+	return ""
+}
+
+// EnvVars returns the PREVIEW_URL_<NAME> environment variables of the URLs
+func EnvVars(urls []v1alpha1.PreviewURL) map[string]string {
+	answer := map[string]string{}
+	for i := range urls {
+		name := EnvVarName(urls[i].Name)
+		if _, exists := answer[name]; !exists {
+			answer[name] = urls[i].URL
+		}
+	}
+	return answer
+}
+
+// EnvVarName returns the name of the environment variable of the URL with the given name
+func EnvVarName(name string) string {
+	return EnvVarPrefix + invalidEnvVarChars.ReplaceAllString(strings.ToUpper(name), "_")
+}
+
+func ingressHasTLS(ing *networkingv1.Ingress, host string) bool {
+	for _, t := range ing.Spec.TLS {
+		for _, h := range t.Hosts {
+			if h == host || (strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rulePath(rule networkingv1.IngressRule) string {
+	if rule.HTTP == nil || len(rule.HTTP.Paths) == 0 {
+		return ""
+	}
+	return rule.HTTP.Paths[0].Path
+}
+
+func toURL(tls bool, host, path string) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+	url := scheme + "://" + host
+	// regular expression paths cannot be browsed to
+	if path != "" && path != "/" && !strings.ContainsAny(path, "()*$^") {
+		url += "/" + strings.TrimPrefix(path, "/")
+	}
+	return url
+}
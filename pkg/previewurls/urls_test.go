@@ -0,0 +1,92 @@
+package previewurls_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewurls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynfake "k8s.io/client-go/dynamic/fake"
+	fakekube "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIngressURLs(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	kubeClient := fakekube.NewSimpleClientset(
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: ns},
+			Spec: networkingv1.IngressSpec{
+				TLS: []networkingv1.IngressTLS{{Hosts: []string{"*.example.com"}}},
+				Rules: []networkingv1.IngressRule{
+					{
+						Host: "api-pr-1.example.com",
+						IngressRuleValue: networkingv1.IngressRuleValue{
+							HTTP: &networkingv1.HTTPIngressRuleValue{
+								Paths: []networkingv1.HTTPIngressPath{{Path: "/v1"}},
+							},
+						},
+					},
+					{Host: "api-pr-1.other.com"},
+				},
+			},
+		},
+		&networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{Name: "ui", Namespace: ns},
+			Spec: networkingv1.IngressSpec{
+				Rules: []networkingv1.IngressRule{
+					{
+						Host: "ui-pr-1.example.com",
+						IngressRuleValue: networkingv1.IngressRuleValue{
+							HTTP: &networkingv1.HTTPIngressRuleValue{
+								Paths: []networkingv1.HTTPIngressPath{{Path: "/(.*)"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	urls, err := previewurls.IngressURLs(context.Background(), kubeClient, ns)
+	require.NoError(t, err, "failed to find ingress URLs")
+	previewurls.SortURLs(urls)
+	assert.Equal(t, []v1alpha1.PreviewURL{
+		{Name: "api", URL: "https://api-pr-1.example.com/v1", Kind: previewurls.KindIngress},
+		{Name: "api-2", URL: "http://api-pr-1.other.com", Kind: previewurls.KindIngress},
+		{Name: "ui", URL: "http://ui-pr-1.example.com", Kind: previewurls.KindIngress},
+	}, urls)
+
+	envVars := previewurls.EnvVars(urls)
+	assert.Equal(t, "http://api-pr-1.other.com", envVars["PREVIEW_URL_API_2"], "env var of api-2")
+	assert.Equal(t, "http://ui-pr-1.example.com", previewurls.FindURL(urls, "ui"), "ui URL")
+}
+
+func TestRouteURLs(t *testing.T) {
+	ns := "jx-myowner-myrepo-pr-1"
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"host": "admin-pr-1.apps.example.com",
+			"tls":  map[string]interface{}{"termination": "edge"},
+		},
+	}}
+	route.SetAPIVersion("route.openshift.io/v1")
+	route.SetKind("Route")
+	route.SetNamespace(ns)
+	route.SetName("admin")
+
+	dynamicClient := dynfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{previewurls.RoutesResource: "RouteList"}, route)
+
+	urls, err := previewurls.RouteURLs(context.Background(), dynamicClient, ns)
+	require.NoError(t, err, "failed to find route URLs")
+	assert.Equal(t, []v1alpha1.PreviewURL{
+		{Name: "admin", URL: "https://admin-pr-1.apps.example.com", Kind: previewurls.KindRoute},
+	}, urls)
+}
@@ -0,0 +1,185 @@
+package quotas
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+)
+
+// Scope the kind of previews a quota applies to
+type Scope string
+
+const (
+	// ScopeGlobal the quota applies to all previews
+	ScopeGlobal Scope = "global"
+
+	// ScopeRepository the quota applies to the previews of a repository
+	ScopeRepository Scope = "repository"
+
+	// ScopeAuthor the quota applies to the previews of a pull request author
+	ScopeAuthor Scope = "author"
+)
+
+// Violation a quota which is exceeded
+type Violation struct {
+	Scope Scope
+	Key   string
+	Limit int
+	Count int
+}
+
+// String returns a description of the violation
+func (v *Violation) String() string {
+	switch v.Scope {
+	case ScopeRepository:
+		return fmt.Sprintf("the limit of %d previews for repository %s", v.Limit, v.Key)
+	case ScopeAuthor:
+		return fmt.Sprintf("the limit of %d previews for author %s", v.Limit, v.Key)
+	default:
+		return fmt.Sprintf("the limit of %d previews", v.Limit)
+	}
+}
+
+// Violations returns the quotas which would be exceeded if the candidate preview was added to the previews.
+// If candidate is nil the quotas exceeded by the previews themselves are returned
+func Violations(q *previewconfig.Quotas, resources []v1alpha1.Preview, candidate *v1alpha1.Preview) []Violation {
+	return violations(q, withCandidate(resources, candidate))
+}
+
+// Evictions returns the least recently updated previews to remove so that the previews and the
+// optional candidate preview fit within the quotas. The candidate is never evicted
+func Evictions(q *previewconfig.Quotas, resources []v1alpha1.Preview, candidate *v1alpha1.Preview) []*v1alpha1.Preview {
+	all := withCandidate(resources, candidate)
+
+	var evictable []*v1alpha1.Preview
+	for _, p := range all {
+		if candidate == nil || p.Name != candidate.Name {
+			evictable = append(evictable, p)
+		}
+	}
+	sort.SliceStable(evictable, func(i, j int) bool {
+		return LastUpdated(evictable[i]).Before(LastUpdated(evictable[j]))
+	})
+
+	var answer []*v1alpha1.Preview
+	for {
+		vs := violations(q, all)
+		if len(vs) == 0 {
+			return answer
+		}
+		v := vs[0]
+		idx := -1
+		for i, p := range evictable {
+			if matches(v.Scope, v.Key, p) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return answer
+		}
+		victim := evictable[idx]
+		answer = append(answer, victim)
+		evictable = append(evictable[:idx], evictable[idx+1:]...)
+		all = remove(all, victim)
+	}
+}
+
+// LastUpdated returns the time the preview was last deployed, defaulting to its creation time
+func LastUpdated(preview *v1alpha1.Preview) time.Time {
+	text := preview.Annotations[previews.AnnotationLastUpdated]
+	if text != "" {
+		t, err := time.Parse(time.RFC3339, text)
+		if err == nil {
+			return t
+		}
+	}
+	return preview.CreationTimestamp.Time
+}
+
+func violations(q *previewconfig.Quotas, all []*v1alpha1.Preview) []Violation {
+	var answer []Violation
+	if q.MaxPreviews > 0 && len(all) > q.MaxPreviews {
+		answer = append(answer, Violation{Scope: ScopeGlobal, Limit: q.MaxPreviews, Count: len(all)})
+	}
+	if q.MaxPreviewsPerRepository > 0 {
+		answer = append(answer, countViolations(ScopeRepository, q.MaxPreviewsPerRepository, all)...)
+	}
+	if q.MaxPreviewsPerAuthor > 0 {
+		answer = append(answer, countViolations(ScopeAuthor, q.MaxPreviewsPerAuthor, all)...)
+	}
+	return answer
+}
+
+func countViolations(scope Scope, limit int, all []*v1alpha1.Preview) []Violation {
+	counts := map[string]int{}
+	var keys []string
+	for _, p := range all {
+		key := keyOf(scope, p)
+		if key == "" {
+			continue
+		}
+		if counts[key] == 0 {
+			keys = append(keys, key)
+		}
+		counts[key]++
+	}
+	var answer []Violation
+	for _, key := range keys {
+		if counts[key] > limit {
+			answer = append(answer, Violation{Scope: scope, Key: key, Limit: limit, Count: counts[key]})
+		}
+	}
+	return answer
+}
+
+func keyOf(scope Scope, p *v1alpha1.Preview) string {
+	pr := &p.Spec.PullRequest
+	switch scope {
+	case ScopeRepository:
+		if pr.Owner == "" || pr.Repository == "" {
+			return ""
+		}
+		return pr.Owner + "/" + pr.Repository
+	case ScopeAuthor:
+		return pr.User.Username
+	default:
+		return ""
+	}
+}
+
+func matches(scope Scope, key string, p *v1alpha1.Preview) bool {
+	if scope == ScopeGlobal {
+		return true
+	}
+	return keyOf(scope, p) == key
+}
+
+func withCandidate(resources []v1alpha1.Preview, candidate *v1alpha1.Preview) []*v1alpha1.Preview {
+	var answer []*v1alpha1.Preview
+	for i := range resources {
+		p := &resources[i]
+		if candidate != nil && p.Name == candidate.Name {
+			continue
+		}
+		answer = append(answer, p)
+	}
+	if candidate != nil {
+		answer = append(answer, candidate)
+	}
+	return answer
+}
+
+func remove(all []*v1alpha1.Preview, victim *v1alpha1.Preview) []*v1alpha1.Preview {
+	var answer []*v1alpha1.Preview
+	for _, p := range all {
+		if p != victim {
+			answer = append(answer, p)
+		}
+	}
+	return answer
+}
@@ -0,0 +1,106 @@
+package quotas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/apis/preview/v1alpha1"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previewconfig"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/previews"
+	"github.com/jenkins-x-plugins/jx-preview/pkg/quotas"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestQuotas(t *testing.T) {
+	now := time.Now()
+	newPreview := func(name, repo, author string, age time.Duration) v1alpha1.Preview {
+		return v1alpha1.Preview{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+				Annotations: map[string]string{
+					previews.AnnotationLastUpdated: now.Add(-age).Format(time.RFC3339),
+				},
+			},
+			Spec: v1alpha1.PreviewSpec{
+				PullRequest: v1alpha1.PullRequest{
+					Owner:      "myorg",
+					Repository: repo,
+					User: v1alpha1.UserSpec{
+						Username: author,
+					},
+				},
+			},
+		}
+	}
+
+	resources := []v1alpha1.Preview{
+		newPreview("app-pr-1", "app", "alice", 3*time.Hour),
+		newPreview("app-pr-2", "app", "bob", 1*time.Hour),
+		newPreview("api-pr-1", "api", "alice", 5*time.Hour),
+		newPreview("api-pr-2", "api", "bob", 2*time.Hour),
+	}
+	candidate := newPreview("app-pr-3", "app", "carol", 0)
+
+	testCases := []struct {
+		name              string
+		quotas            previewconfig.Quotas
+		candidate         *v1alpha1.Preview
+		expectedScopes    []quotas.Scope
+		expectedEvictions []string
+	}{
+		{
+			name:      "unlimited",
+			candidate: &candidate,
+		},
+		{
+			name:              "global",
+			quotas:            previewconfig.Quotas{MaxPreviews: 4},
+			candidate:         &candidate,
+			expectedScopes:    []quotas.Scope{quotas.ScopeGlobal},
+			expectedEvictions: []string{"api-pr-1"},
+		},
+		{
+			name:              "repository",
+			quotas:            previewconfig.Quotas{MaxPreviewsPerRepository: 2},
+			candidate:         &candidate,
+			expectedScopes:    []quotas.Scope{quotas.ScopeRepository},
+			expectedEvictions: []string{"app-pr-1"},
+		},
+		{
+			name:           "author-not-exceeded-by-candidate",
+			quotas:         previewconfig.Quotas{MaxPreviewsPerAuthor: 2},
+			candidate:      &candidate,
+			expectedScopes: nil,
+		},
+		{
+			name:              "gc-author",
+			quotas:            previewconfig.Quotas{MaxPreviewsPerAuthor: 1},
+			expectedScopes:    []quotas.Scope{quotas.ScopeAuthor, quotas.ScopeAuthor},
+			expectedEvictions: []string{"api-pr-1", "api-pr-2"},
+		},
+		{
+			name:              "existing-preview-is-not-new",
+			quotas:            previewconfig.Quotas{MaxPreviews: 4},
+			candidate:         &resources[1],
+			expectedScopes:    nil,
+			expectedEvictions: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		violations := quotas.Violations(&tc.quotas, resources, tc.candidate)
+		var scopes []quotas.Scope
+		for _, v := range violations {
+			scopes = append(scopes, v.Scope)
+		}
+		assert.Equal(t, tc.expectedScopes, scopes, "violations for test %s", tc.name)
+
+		evictions := quotas.Evictions(&tc.quotas, resources, tc.candidate)
+		var names []string
+		for _, p := range evictions {
+			names = append(names, p.Name)
+		}
+		assert.Equal(t, tc.expectedEvictions, names, "evictions for test %s", tc.name)
+	}
+}
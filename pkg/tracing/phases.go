@@ -0,0 +1,48 @@
+package tracing
+
+import "go.opentelemetry.io/otel/attribute"
+
+// Phases traces the sequential phases of an operation as child spans of the span of the operation
+type Phases struct {
+	span    *Span
+	current *Span
+	name    string
+}
+
+// NewPhases creates the phases of the span which may be nil if tracing is disabled
+func NewPhases(span *Span) *Phases {
+	return &Phases{span: span}
+}
+
+// Start ends the current phase and starts the next one
+func (p *Phases) Start(name string, attributes ...attribute.KeyValue) {
+	p.current.End()
+	p.current = p.span.Start(name, attributes...)
+	p.name = name
+}
+
+// Name returns the name of the current phase
+func (p *Phases) Name() string {
+	return p.name
+}
+
+// Span returns the span of the current phase falling back to the span of the operation
+func (p *Phases) Span() *Span {
+	if p.current != nil {
+		return p.current
+	}
+	return p.span
+}
+
+// Root returns the span of the operation
+func (p *Phases) Root() *Span {
+	return p.span
+}
+
+// End ends the current phase and the operation recording the error of the operation if it failed
+func (p *Phases) End(err error) {
+	p.current.RecordError(err)
+	p.current.End()
+	p.span.RecordError(err)
+	p.span.End()
+}
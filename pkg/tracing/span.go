@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// EnvTraceParent the environment variable used to pass the W3C trace context to spawned commands
+	EnvTraceParent = "TRACEPARENT"
+
+	// EnvTraceState the environment variable used to pass the W3C trace state to spawned commands
+	EnvTraceState = "TRACESTATE"
+)
+
+// Span a timed operation of a trace. All the methods of a nil span do nothing so callers
+// do not need to check if tracing is enabled
+type Span struct {
+	tracer *Tracer
+	ctx    context.Context
+	span   trace.Span
+}
+
+// Start starts a child span of the span
+func (s *Span) Start(name string, attributes ...attribute.KeyValue) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.start(s.ctx, name, attributes)
+}
+
+// SetAttributes adds the attributes to the span
+func (s *Span) SetAttributes(attributes ...attribute.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributes...)
+}
+
+// RecordError marks the span as failed if the error is not nil
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span so that it is exported. Ending a span more than once does nothing
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// TraceID returns the hex encoded trace ID or an empty string if tracing is disabled
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.span.SpanContext().TraceID().String()
+}
+
+// TraceParent returns the W3C traceparent of the span or an empty string if tracing is disabled
+func (s *Span) TraceParent() string {
+	return s.carrier().Get("traceparent")
+}
+
+func (s *Span) carrier() propagation.MapCarrier {
+	carrier := propagation.MapCarrier{}
+	if s != nil {
+		propagation.TraceContext{}.Inject(s.ctx, carrier)
+	}
+	return carrier
+}
+
+// InjectEnv returns a copy of the environment variables of a command including the trace context of the span
+// so that the command can continue the trace
+func InjectEnv(span *Span, env map[string]string) map[string]string {
+	if span == nil {
+		return env
+	}
+	answer := map[string]string{}
+	for k, v := range env {
+		answer[k] = v
+	}
+	carrier := span.carrier()
+	answer[EnvTraceParent] = carrier.Get("traceparent")
+	if state := carrier.Get("tracestate"); state != "" {
+		answer[EnvTraceState] = state
+	}
+	return answer
+}
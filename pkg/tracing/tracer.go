@@ -0,0 +1,165 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// EnvEndpoint the standard environment variable for the base URL of the OTLP endpoint
+	EnvEndpoint = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+	// EnvTracesEndpoint the standard environment variable for the URL of the OTLP traces endpoint
+	EnvTracesEndpoint = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+
+	// EnvProtocol the standard environment variable for the OTLP protocol
+	EnvProtocol = "OTEL_EXPORTER_OTLP_PROTOCOL"
+
+	// EnvTracesProtocol the standard environment variable for the OTLP protocol of traces
+	EnvTracesProtocol = "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"
+
+	// EnvSDKDisabled the standard environment variable to disable OpenTelemetry
+	EnvSDKDisabled = "OTEL_SDK_DISABLED"
+
+	// EnvTracesExporter the standard environment variable for the traces exporter
+	EnvTracesExporter = "OTEL_TRACES_EXPORTER"
+
+	// ProtocolGRPC the OTLP/gRPC protocol
+	ProtocolGRPC = "grpc"
+
+	// ProtocolHTTPProtobuf the OTLP/HTTP protocol with binary protobuf payloads which is the default
+	ProtocolHTTPProtobuf = "http/protobuf"
+
+	// DefaultServiceName the name of the service if none is configured
+	DefaultServiceName = "jx-preview"
+
+	// InstrumentationName the name of the tracer of the spans
+	InstrumentationName = "github.com/jenkins-x-plugins/jx-preview"
+
+	flushTimeout = 10 * time.Second
+)
+
+// Tracer records spans with the OpenTelemetry SDK. A nil tracer is disabled and only creates nil spans
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+
+	// parent continues a trace started by the process which invoked this one
+	parent context.Context
+}
+
+// NewTracer creates a tracer which records spans with the provider continuing the trace of the $TRACEPARENT of the process
+func NewTracer(provider *sdktrace.TracerProvider) *Tracer {
+	carrier := propagation.MapCarrier{
+		"traceparent": os.Getenv(EnvTraceParent),
+		"tracestate":  os.Getenv(EnvTraceState),
+	}
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(InstrumentationName),
+		parent:   propagation.TraceContext{}.Extract(context.Background(), carrier),
+	}
+}
+
+// NewTracerFromEnv creates a tracer exporting over OTLP configured with the standard OpenTelemetry environment variables
+// or returns nil if no OTLP endpoint is configured or tracing is disabled
+func NewTracerFromEnv() (*Tracer, error) {
+	if strings.EqualFold(os.Getenv(EnvSDKDisabled), "true") || os.Getenv(EnvTracesExporter) == "none" {
+		return nil, nil
+	}
+	if os.Getenv(EnvTracesEndpoint) == "" && os.Getenv(EnvEndpoint) == "" {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	var exporter sdktrace.SpanExporter
+	var err error
+	protocol := firstEnv(EnvTracesProtocol, EnvProtocol)
+	switch protocol {
+	case "", ProtocolHTTPProtobuf:
+		exporter, err = otlptracehttp.New(ctx)
+	case ProtocolGRPC:
+		exporter, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported OTLP protocol %s, supported values are %s and %s", protocol, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP %s exporter: %w", protocol, err)
+	}
+
+	// the environment overrides the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", DefaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the OpenTelemetry resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	return NewTracer(provider), nil
+}
+
+// LazyCreateTracer creates a tracer from the environment if one is not already configured
+func LazyCreateTracer(tracer *Tracer) (*Tracer, error) {
+	if tracer != nil {
+		return tracer, nil
+	}
+	return NewTracerFromEnv()
+}
+
+// Enabled returns true if spans are recorded
+func (t *Tracer) Enabled() bool {
+	return t != nil
+}
+
+// Start starts a root span which continues the trace of the $TRACEPARENT of the process if there is one
+func (t *Tracer) Start(name string, attributes ...attribute.KeyValue) *Span {
+	if t == nil {
+		return nil
+	}
+	return t.start(t.parent, name, attributes)
+}
+
+func (t *Tracer) start(parent context.Context, name string, attributes []attribute.KeyValue) *Span {
+	ctx, span := t.tracer.Start(parent, name, trace.WithAttributes(attributes...))
+	return &Span{tracer: t, ctx: ctx, span: span}
+}
+
+// Flush exports the ended spans
+func (t *Tracer) Flush() error {
+	if t == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	err := t.provider.ForceFlush(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	return nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		value := os.Getenv(name)
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
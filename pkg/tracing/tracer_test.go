@@ -0,0 +1,110 @@
+package tracing_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-preview/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	t.Setenv(tracing.EnvTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := tracing.NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	require.True(t, tracer.Enabled(), "tracer should be enabled")
+
+	root := tracer.Start("create", attribute.String("vcs.repository.name", "myrepo"))
+	phases := tracing.NewPhases(root)
+	phases.Start("deploy")
+	env := tracing.InjectEnv(phases.Span(), map[string]string{"PREVIEW_NAMESPACE": "jx-myrepo-pr-1"})
+	assert.Equal(t, phases.Span().TraceParent(), env[tracing.EnvTraceParent], "injected trace parent")
+	assert.Equal(t, "jx-myrepo-pr-1", env["PREVIEW_NAMESPACE"], "existing env var")
+	root.SetAttributes(attribute.Int("vcs.change.id", 123))
+	phases.End(errors.New("helmfile sync failed"))
+	require.NoError(t, tracer.Flush(), "failed to flush spans")
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2, "spans")
+	deploy, create := spans[0], spans[1]
+	assert.Equal(t, "deploy", deploy.Name, "phase span name")
+	assert.Equal(t, "create", create.Name, "root span name")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", create.SpanContext.TraceID().String(), "root span continues the trace parent")
+	assert.Equal(t, "00f067aa0ba902b7", create.Parent.SpanID().String(), "root span parent")
+	assert.Equal(t, create.SpanContext.TraceID(), deploy.SpanContext.TraceID(), "phase trace")
+	assert.Equal(t, create.SpanContext.SpanID(), deploy.Parent.SpanID(), "phase parent")
+	assert.Equal(t, root.TraceID(), create.SpanContext.TraceID().String(), "trace ID")
+	assert.Equal(t, codes.Error, create.Status.Code, "root span status")
+	assert.Equal(t, "helmfile sync failed", deploy.Status.Description, "phase span status message")
+	assert.Equal(t, []attribute.KeyValue{attribute.String("vcs.repository.name", "myrepo"), attribute.Int("vcs.change.id", 123)}, create.Attributes, "root span attributes")
+	assert.Equal(t, "00-"+deploy.SpanContext.TraceID().String()+"-"+deploy.SpanContext.SpanID().String()+"-01", env[tracing.EnvTraceParent], "trace parent of the phase")
+}
+
+func TestTracerFromEnv(t *testing.T) {
+	var path, contentType, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		contentType = req.Header.Get("Content-Type")
+		auth = req.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv(tracing.EnvEndpoint, server.URL)
+	t.Setenv(tracing.EnvTracesEndpoint, "")
+	t.Setenv(tracing.EnvProtocol, "")
+	t.Setenv(tracing.EnvTracesProtocol, "")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20token")
+
+	tracer, err := tracing.NewTracerFromEnv()
+	require.NoError(t, err, "failed to create tracer")
+	require.True(t, tracer.Enabled(), "tracer should be enabled")
+	tracer.Start("gc").End()
+	require.NoError(t, tracer.Flush(), "failed to flush spans")
+
+	assert.Equal(t, "/v1/traces", path, "export path")
+	assert.Equal(t, "application/x-protobuf", contentType, "http/protobuf should be the default protocol")
+	assert.Equal(t, "Bearer token", auth, "authorization header")
+
+	t.Setenv(tracing.EnvProtocol, tracing.ProtocolGRPC)
+	tracer, err = tracing.NewTracerFromEnv()
+	require.NoError(t, err, "failed to create grpc tracer")
+	assert.True(t, tracer.Enabled(), "grpc tracer should be enabled")
+
+	t.Setenv(tracing.EnvTracesProtocol, "http/json")
+	_, err = tracing.NewTracerFromEnv()
+	assert.Error(t, err, "http/json is not supported by the OpenTelemetry exporters")
+}
+
+func TestTracerDisabled(t *testing.T) {
+	t.Setenv(tracing.EnvEndpoint, "")
+	t.Setenv(tracing.EnvTracesEndpoint, "")
+
+	tracer, err := tracing.NewTracerFromEnv()
+	require.NoError(t, err, "failed to create tracer")
+	assert.False(t, tracer.Enabled(), "tracer should be disabled")
+
+	span := tracer.Start("create")
+	phases := tracing.NewPhases(span)
+	phases.Start("deploy")
+	assert.Equal(t, "deploy", phases.Name(), "phase name")
+	env := map[string]string{"A": "B"}
+	assert.Equal(t, env, tracing.InjectEnv(phases.Span(), env), "env should not change")
+	phases.End(errors.New("failed"))
+	assert.Empty(t, span.TraceID(), "trace ID")
+	assert.Empty(t, span.TraceParent(), "trace parent")
+	assert.NoError(t, tracer.Flush(), "flush")
+
+	t.Setenv(tracing.EnvEndpoint, "http://localhost:4318")
+	t.Setenv(tracing.EnvSDKDisabled, "true")
+	tracer, err = tracing.NewTracerFromEnv()
+	require.NoError(t, err, "failed to create disabled tracer")
+	assert.False(t, tracer.Enabled(), "the SDK should be disabled")
+}